@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"generator/internal/config"
+	"generator/internal/generator"
+	"generator/internal/modpath"
+	"generator/internal/outfs"
+	"generator/internal/protoload"
+	"generator/internal/scaffold"
+)
+
+// runAdd добавляет в проект новую часть, пока только сущность
+func runAdd(args []string) error {
+	if len(args) == 0 || args[0] != "entity" {
+		flags, _ := newFlagSet("add")
+		flags.Usage()
+		return fmt.Errorf("expected 'entity' after 'add'")
+	}
+	return runAddEntity(args[1:])
+}
+
+// runAddEntity пишет proto файл новой сущности и перегенерирует сервис.
+// Генератор запоминает отпечатки моделей до добавления, поэтому
+// перегенерируются только новая сущность и модели, которые на неё
+// ссылаются, а для новой таблицы создаётся отдельная миграция. Новый файл
+// сначала проходит lint, а сгенерированный код - проверку типов.
+func runAddEntity(args []string) error {
+	flags, configPath := newFlagSet("add")
+	generate := flags.Bool("generate", true, "Regenerate the service after writing the proto file")
+	verify := flags.Bool("verify", true, "With -generate, type-check the generated module and fail if it does not compile")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("entity name is required")
+	}
+
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+
+	entity := &scaffold.Entity{Name: flags.Arg(0)}
+	if err := scaffold.CheckEntity(entity.Name); err != nil {
+		return err
+	}
+	for _, spec := range flags.Args()[1:] {
+		field, err := scaffold.ParseField(spec)
+		if err != nil {
+			return err
+		}
+		entity.Fields = append(entity.Fields, field)
+	}
+
+	// Имя и ссылки проверяются по уже существующим proto файлам
+	files, err := cfg.ProtoFiles()
+	if err != nil {
+		return err
+	}
+	relFiles := make([]string, 0, len(files))
+	for _, file := range files {
+		rel, err := filepath.Rel(cfg.Proto.Source, file)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", file, err)
+		}
+		relFiles = append(relFiles, filepath.ToSlash(rel))
+	}
+	set, err := protoload.Load(context.Background(), relFiles, cfg.ImportPaths())
+	if err != nil {
+		return fmt.Errorf("failed to compile proto files: %w", err)
+	}
+	overrides, err := cfg.Overrides()
+	if err != nil {
+		return err
+	}
+	set.SetOverrides(overrides)
+
+	entity.Package = scaffold.PackageOf(set, relFiles)
+	if entity.Package == "" {
+		entity.Package = modpath.ProtoPackage(cfg.Module)
+	}
+	if err := entity.Check(set); err != nil {
+		return err
+	}
+
+	path := filepath.Join(cfg.Proto.Source, entity.FileName())
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+
+	content, err := entity.Proto()
+	if err != nil {
+		return err
+	}
+
+	var g *generator.Generator
+	if *generate {
+		if g, err = newGenerator(cfg, true); err != nil {
+			return err
+		}
+		if err := g.Prime(files); err != nil {
+			return fmt.Errorf("failed to parse proto files: %w", err)
+		}
+	}
+
+	step("Writing %s", path)
+	if err := os.MkdirAll(cfg.Proto.Source, 0755); err != nil {
+		return fmt.Errorf("failed to create proto directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if files, err = cfg.ProtoFiles(); err != nil {
+		return err
+	}
+
+	// Файл, который не проходит lint, не оставляем в проекте
+	if err := lintAdded(cfg, files); err != nil {
+		if rmErr := os.Remove(path); rmErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to remove %s: %w", path, rmErr))
+		}
+		return fmt.Errorf("%w, %s was not added", err, path)
+	}
+
+	if !*generate {
+		return nil
+	}
+	if err := buildProto(context.Background(), cfg); err != nil {
+		return err
+	}
+	step("Generating code into %s", cfg.Output.Dir)
+	if err := g.Generate(context.Background(), files, outfs.NewOS(cfg.Output.Dir)); err != nil {
+		return fmt.Errorf("failed to generate code: %w", err)
+	}
+	printSummary(g.Summary(), -1)
+	if *verify {
+		return verifyCode(context.Background(), cfg)
+	}
+	return nil
+}
+
+// lintAdded проверяет proto файлы проекта вместе с новой сущностью и
+// печатает замечания. Ошибкой считаются только замечания уровня error.
+func lintAdded(cfg *config.Config, files []string) error {
+	step("Linting %s", cfg.Proto.Source)
+	g, err := newGenerator(cfg, false)
+	if err != nil {
+		return err
+	}
+	issues, err := g.Lint(files)
+	if err != nil {
+		return err
+	}
+	errs := 0
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+		if issue.Severity == generator.SeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("lint found %d errors", errs)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"generator/internal/config"
+	"generator/internal/generator"
+)
+
+// runBreaking сравнивает текущие proto с прошлой версией: снимком схемы
+// или состоянием в git, и печатает несовместимые изменения API и схемы
+// базы. Команда завершается ошибкой, если есть несовместимые изменения,
+// а с -strict - и миграции, которым нужно заполнение данных.
+func runBreaking(args []string) error {
+	flags, configPath := newFlagSet("breaking")
+	against := flags.String("against", "", "Git ref or schema snapshot file to compare with")
+	save := flags.String("save", "", "Write a schema snapshot of the current protos to this file and exit")
+	format := flags.String("format", "text", "Output format: text or json")
+	strict := flags.Bool("strict", false, "Fail on migrations that need a data backfill as well")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if *against == "" && *save == "" {
+		flags.Usage()
+		return fmt.Errorf("-against or -save is required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, use text or json", *format)
+	}
+
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+	current, err := loadSchema(cfg)
+	if err != nil {
+		return err
+	}
+
+	if *save != "" {
+		var buf bytes.Buffer
+		if err := current.WriteJSON(&buf); err != nil {
+			return fmt.Errorf("failed to encode schema snapshot: %w", err)
+		}
+		if err := os.WriteFile(*save, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", *save, err)
+		}
+		step("Saved schema snapshot to %s", *save)
+		if *against == "" {
+			return nil
+		}
+	}
+
+	previous, err := loadPreviousSchema(cfg, *against)
+	if err != nil {
+		return err
+	}
+	changes := generator.CompareSchemas(previous, current)
+
+	if *format == "json" {
+		if changes == nil {
+			changes = []generator.BreakingChange{}
+		}
+		data, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode changes: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+
+	breaking, backfill := 0, 0
+	for _, c := range changes {
+		if c.Breaking {
+			breaking++
+		}
+		if c.Backfill {
+			backfill++
+		}
+	}
+	if len(changes) == 0 {
+		step("No breaking changes against %s", *against)
+	}
+	if breaking > 0 || (*strict && backfill > 0) {
+		return fmt.Errorf("found %d breaking changes and %d migrations that need a backfill against %s", breaking, backfill, *against)
+	}
+	return nil
+}
+
+// loadSchema возвращает снимок схемы proto файлов проекта
+func loadSchema(cfg *config.Config) (*generator.Schema, error) {
+	files, err := cfg.ProtoFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no proto files in %s", cfg.Proto.Source)
+	}
+	g, err := newGenerator(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	return g.Schema(files)
+}
+
+// loadPreviousSchema читает снимок из файла against или, если такого файла
+// нет, собирает снимок из proto файлов в git ревизии against
+func loadPreviousSchema(cfg *config.Config, against string) (*generator.Schema, error) {
+	if info, err := os.Stat(against); err == nil && !info.IsDir() {
+		f, err := os.Open(against)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", against, err)
+		}
+		defer f.Close()
+		return generator.ReadSchema(f)
+	}
+
+	tmp, err := os.MkdirTemp("", "appgen-breaking-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Исходные proto и директории импортов из репозитория берутся в том
+	// виде, в каком они были в ревизии against
+	old := *cfg
+	old.Proto.Source = filepath.Join(tmp, "source")
+	if err := gitExport(against, cfg.Proto.Source, old.Proto.Source); err != nil {
+		return nil, err
+	}
+	old.Proto.ImportPaths = make([]string, len(cfg.Proto.ImportPaths))
+	for i, dir := range cfg.Proto.ImportPaths {
+		old.Proto.ImportPaths[i] = filepath.Join(tmp, "import"+strconv.Itoa(i))
+		if err := gitExport(against, dir, old.Proto.ImportPaths[i]); errors.Is(err, errNotInRepo) {
+			old.Proto.ImportPaths[i] = dir
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	old.Plugins = nil
+
+	schema, err := loadSchema(&old)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", against, err)
+	}
+	return schema, nil
+}
+
+var errNotInRepo = errors.New("not in a git repository")
+
+// gitExport выгружает содержимое директории dir в ревизии ref в dst
+func gitExport(ref, dir, dst string) error {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel", "--show-prefix").Output()
+	if err != nil {
+		return fmt.Errorf("%s: %w", dir, errNotInRepo)
+	}
+	// Префикс пуст, если dir - корень репозитория
+	lines := strings.SplitN(strings.TrimRight(string(out), "\n"), "\n", 2)
+	root, prefix := lines[0], ""
+	if len(lines) > 1 {
+		prefix = lines[1]
+	}
+
+	// git archive выгружает поддерево только из корня репозитория
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", root, "archive", "--format=tar", ref+":"+prefix)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to read %s at %s: %s", dir, ref, strings.TrimSpace(stderr.String()))
+	}
+
+	archive := tar.NewReader(&stdout)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s at %s: %w", dir, ref, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		path := filepath.Join(dst, filepath.FromSlash(header.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return fmt.Errorf("failed to read %s at %s: %w", header.Name, ref, err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+}
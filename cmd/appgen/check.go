@@ -0,0 +1,20 @@
+package main
+
+// runCheck собирает сгенерированный сервис и проверяет его go vet
+func runCheck(args []string) error {
+	flags, configPath := newFlagSet("check")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+
+	step("Building %s", cfg.Output.Dir)
+	if err := goCommand(cfg.Output.Dir, "build", "./..."); err != nil {
+		return err
+	}
+	step("Vetting %s", cfg.Output.Dir)
+	return goCommand(cfg.Output.Dir, "vet", "./...")
+}
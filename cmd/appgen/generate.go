@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"generator/internal/config"
+	"generator/internal/generator"
+	"generator/internal/outfs"
+	"generator/internal/protoc"
+	"generator/internal/protogen"
+)
+
+// runProto генерирует выходные proto и Go код для них
+func runProto(args []string) error {
+	flags, configPath := newFlagSet("proto")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+	return buildProto(context.Background(), cfg)
+}
+
+// runGenerate проходит весь путь от исходных proto до готового модуля
+func runGenerate(args []string) error {
+	flags, configPath := newFlagSet("generate")
+	upgrade := flags.Bool("upgrade", false, "Three-way merge new templates into already customised files")
+	tidy := flags.Bool("tidy", true, "Run go mod tidy in the output directory")
+	watch := flags.Bool("watch", false, "Keep running and regenerate when protos, the config or templates change")
+	debounce := flags.Duration("debounce", 300*time.Millisecond, "With -watch, wait this long after the last change before regenerating")
+	restart := flags.Bool("restart", false, "With -watch, build and restart the service after every regeneration")
+	dryRun := flags.Bool("dry-run", false, "Report what would be generated, including plugin files, without writing anything")
+	verify := flags.Bool("verify", true, "Type-check the generated module and fail if it does not compile")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *watch && *upgrade {
+		return fmt.Errorf("-watch cannot be combined with -upgrade")
+	}
+	if *watch && *dryRun {
+		return fmt.Errorf("-watch cannot be combined with -dry-run")
+	}
+	if *restart && !*watch {
+		return fmt.Errorf("-restart requires -watch")
+	}
+	if *watch {
+		w := &watcher{
+			configPath: *configPath,
+			load:       func() (*config.Config, error) { return loadConfig(flags, *configPath) },
+			debounce:   *debounce,
+			tidy:       *tidy,
+			verify:     *verify,
+			restart:    *restart,
+		}
+		return w.run(context.Background())
+	}
+
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+
+	// Пробный запуск не компилирует proto: код генерируется по исходным
+	if !*dryRun {
+		if err := buildProto(context.Background(), cfg); err != nil {
+			return err
+		}
+	}
+	summary, err := generateCode(cfg, *upgrade, *dryRun)
+	if err != nil {
+		return err
+	}
+	if summary != nil {
+		printSummary(*summary, 20)
+	}
+	if *dryRun {
+		step("Dry run, nothing was written")
+		return nil
+	}
+
+	if *tidy {
+		step("Tidying %s/go.mod", cfg.Output.Dir)
+		if err := goCommand(cfg.Output.Dir, "mod", "tidy"); err != nil {
+			return err
+		}
+	}
+	if *verify {
+		return verifyCode(context.Background(), cfg)
+	}
+	return nil
+}
+
+// verifyCode проверяет, что сгенерированный модуль компилируется, и
+// печатает ошибки с шаблоном и моделью, которые записали файл
+func verifyCode(ctx context.Context, cfg *config.Config) error {
+	step("Type-checking %s", cfg.Output.Dir)
+	issues, err := generator.Verify(ctx, cfg.Output.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to verify generated code: %w", err)
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("generated code does not compile: %d errors", len(issues))
+	}
+	return nil
+}
+
+// buildProto генерирует выходные proto из исходных и компилирует их в Go код
+func buildProto(ctx context.Context, cfg *config.Config) error {
+	overrides, err := cfg.Overrides()
+	if err != nil {
+		return err
+	}
+
+	step("Generating protos from %s into %s", cfg.Proto.Source, cfg.ProtoDir())
+	pg := protogen.NewProtoGen(cfg.Proto.Source, cfg.ProtoDir(), cfg.Module, cfg.Proto.Package)
+	pg.SetImportPaths(cfg.Proto.ImportPaths)
+	pg.SetOverrides(overrides)
+	pg.SetLegacyEntities(cfg.LegacyEntities)
+	pg.SetLogger(logger)
+	if err := pg.Generate(); err != nil {
+		return fmt.Errorf("failed to generate proto files: %w", err)
+	}
+
+	step("Compiling protos to Go")
+	opts := protoc.Options{
+		Dir:     cfg.ProtoDir(),
+		Gateway: cfg.Features.Gateway,
+	}
+	if err := protoc.Generate(ctx, opts); err != nil {
+		return fmt.Errorf("failed to compile proto files: %w", err)
+	}
+	return nil
+}
+
+// generateCode генерирует код сервиса в выходную директорию и возвращает
+// итог запуска. При обновлении вместо итога печатается отчёт. Пробный
+// запуск держит записанные файлы в памяти.
+func generateCode(cfg *config.Config, upgrade, dryRun bool) (*generator.Summary, error) {
+	files, err := cfg.ProtoFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no proto files in %s", cfg.Proto.Source)
+	}
+
+	g, err := newGenerator(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var dst outfs.FS = outfs.NewOS(cfg.Output.Dir)
+	if dryRun {
+		dst = outfs.NewDryRun(dst)
+	}
+
+	ctx := context.Background()
+	if !upgrade {
+		step("Generating code into %s", cfg.Output.Dir)
+		if err := g.Generate(ctx, files, dst); err != nil {
+			return nil, fmt.Errorf("failed to generate code: %w", err)
+		}
+		summary := g.Summary()
+		return &summary, nil
+	}
+
+	step("Upgrading code in %s", cfg.Output.Dir)
+	report, err := g.Upgrade(ctx, files, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade code: %w", err)
+	}
+	report.Print(os.Stdout)
+	if len(report.Conflicts()) > 0 && !dryRun {
+		return nil, fmt.Errorf("upgrade finished with conflicts, resolve the conflict markers and commit the result")
+	}
+	return nil, nil
+}
+
+// newGenerator создаёт генератор по настройкам проекта
+func newGenerator(cfg *config.Config, incremental bool) (*generator.Generator, error) {
+	opts, err := cfg.GeneratorOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Incremental = incremental
+	opts.Logger = logger
+	g, err := generator.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create generator: %w", err)
+	}
+	return g, nil
+}
+
+// printSummary выводит итог генерации: изменённые файлы, не больше limit
+// (все при -v или limit < 0), и итоговую строку. При -log-format=json итог
+// пишется одной записью журнала.
+func printSummary(s generator.Summary, limit int) {
+	if logOptions.verbose {
+		limit = -1
+	}
+	switch {
+	case logOptions.format == "json":
+		logger.Info("summary",
+			"created", s.Paths(generator.ChangeCreated),
+			"updated", s.Paths(generator.ChangeUpdated),
+			"removed", s.Paths(generator.ChangeRemoved),
+			"models", s.Models,
+			"migrations", s.Migrations)
+	case !logOptions.quiet:
+		s.Print(os.Stdout, limit)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"generator/internal/generator"
+)
+
+// graphFormats - форматы appgen graph и расширения файлов, по которым
+// формат выбирается без -format
+var graphFormats = map[string]string{
+	"dot":     ".dot",
+	"mermaid": ".mmd",
+	"json":    ".json",
+}
+
+// runGraph выгружает схему моделей и ссылок между ними из исходных proto
+func runGraph(args []string) error {
+	flags, configPath := newFlagSet("graph")
+	format := flags.String("format", "mermaid", "Output format: dot, mermaid or json")
+	outPath := flags.String("o", "", "Write the graph to this file instead of stdout")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if !isSet(flags, "format") && *outPath != "" {
+		for name, ext := range graphFormats {
+			if filepath.Ext(*outPath) == ext {
+				*format = name
+			}
+		}
+	}
+	if _, ok := graphFormats[*format]; !ok {
+		return fmt.Errorf("unknown format %q, use dot, mermaid or json", *format)
+	}
+
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+	files, err := cfg.ProtoFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no proto files in %s", cfg.Proto.Source)
+	}
+	g, err := newGenerator(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	models, err := g.Models(files)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	graph := generator.NewGraph(models)
+	switch *format {
+	case "dot":
+		err = graph.WriteDOT(&buf)
+	case "json":
+		err = graph.WriteJSON(&buf)
+	default:
+		err = graph.WriteMermaid(&buf)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+
+	if *outPath == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(*outPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *outPath, err)
+	}
+	return nil
+}
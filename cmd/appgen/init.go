@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"generator/internal/config"
+	"generator/internal/modpath"
+	"generator/internal/scaffold"
+)
+
+// ciProviders - допустимые значения features.ci
+var ciProviders = []string{"gitlab", "github", "none"}
+
+// runInit создаёт новый проект: appgen.yaml, директорию proto с примером
+// сущности и .gitignore. Параметры берутся из флагов, а если ввод идёт с
+// терминала и -y не задан, недостающие спрашиваются у пользователя.
+func runInit(args []string) error {
+	defaults := config.Default()
+
+	flags, configPath := newFlagSet("init")
+	module := flags.String("module", defaults.Module, "Go module path of the generated service")
+	entity := flags.String("entity", scaffold.DefaultEntity, "Sample entity message written to the proto directory, empty for none")
+	gateway := flags.Bool("gateway", defaults.Features.Gateway, "Generate the HTTP gateway")
+	docker := flags.Bool("docker", defaults.Features.Docker, "Generate Dockerfile and docker-compose.yml")
+	tests := flags.Bool("tests", defaults.Features.Tests, "Generate gRPC integration tests")
+	ci := flags.String("ci", defaults.Features.CI, "CI provider: "+strings.Join(ciProviders, ", "))
+	yes := flags.Bool("y", false, "Do not ask questions, use flags and defaults")
+	force := flags.Bool("force", false, "Overwrite existing files")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("too many arguments")
+	}
+
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	if !*yes && isTerminal(os.Stdin) {
+		w := wizard{flags: flags, prompter: newPrompter()}
+		w.text(module, "module", "Go module path", modpath.Check)
+		w.text(entity, "entity", `Sample entity message ("-" for none)`, checkEntity)
+		w.confirm(gateway, "gateway", "Generate the HTTP gateway?")
+		w.confirm(docker, "docker", "Generate Dockerfile and docker-compose.yml?")
+		w.confirm(tests, "tests", "Generate gRPC integration tests?")
+		w.text(ci, "ci", "CI provider ("+strings.Join(ciProviders, ", ")+")", checkCI)
+		if w.err != nil {
+			return w.err
+		}
+		if *entity == "-" {
+			*entity = ""
+		}
+	}
+
+	if err := modpath.Check(*module); err != nil {
+		return err
+	}
+	if *entity != "" {
+		if err := scaffold.CheckEntity(*entity); err != nil {
+			return err
+		}
+	}
+	if err := checkCI(*ci); err != nil {
+		return err
+	}
+
+	cfg := config.Default()
+	cfg.Module = *module
+	cfg.Features.Gateway = *gateway
+	cfg.Features.Docker = *docker
+	cfg.Features.Tests = *tests
+	cfg.Features.CI = *ci
+
+	protoDir := filepath.Join(dir, cfg.Proto.Source)
+	hasProtos, err := containsProtos(protoDir)
+	if err != nil {
+		return err
+	}
+	if hasProtos && *entity != "" {
+		fmt.Printf("%s already contains proto files, skipping the sample entity\n", protoDir)
+		*entity = ""
+	}
+
+	files, err := scaffold.Files(scaffold.Options{Config: cfg, Entity: *entity})
+	if err != nil {
+		return err
+	}
+	for i := range files {
+		if files[i].Path == config.FileName {
+			files[i].Path = *configPath
+		}
+		if !filepath.IsAbs(files[i].Path) {
+			files[i].Path = filepath.Join(dir, files[i].Path)
+		}
+	}
+
+	if !*force {
+		var existing []string
+		for _, f := range files {
+			if _, err := os.Stat(f.Path); err == nil {
+				existing = append(existing, f.Path)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to check %s: %w", f.Path, err)
+			}
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("%s already exist, use -force to overwrite", strings.Join(existing, ", "))
+		}
+	}
+
+	step("Creating %s", protoDir)
+	if err := os.MkdirAll(protoDir, 0755); err != nil {
+		return fmt.Errorf("failed to create proto directory: %w", err)
+	}
+	for _, f := range files {
+		step("Writing %s", f.Path)
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(f.Path, f.Content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+	}
+
+	fmt.Printf("\nProject created. Describe entities in %s, then run:\n", protoDir)
+	if dir != "." {
+		fmt.Printf("  cd %s\n", dir)
+	}
+	fmt.Printf("  appgen generate\n")
+	if cfg.Features.Docker {
+		fmt.Printf("  docker compose -f %s up -d db\n", filepath.Join(cfg.Output.Dir, "docker-compose.yml"))
+	}
+	fmt.Printf("  appgen run -migrate\n")
+	return nil
+}
+
+// wizard спрашивает значения, не заданные флагами. Первая ошибка
+// прекращает опрос и сохраняется в err.
+type wizard struct {
+	flags    *flag.FlagSet
+	prompter *prompter
+	err      error
+}
+
+func (w *wizard) text(value *string, name, question string, check func(string) error) {
+	if w.err != nil || isSet(w.flags, name) {
+		return
+	}
+	*value, w.err = w.prompter.ask(question, *value, check)
+}
+
+func (w *wizard) confirm(value *bool, name, question string) {
+	if w.err != nil || isSet(w.flags, name) {
+		return
+	}
+	*value, w.err = w.prompter.confirm(question, *value)
+}
+
+func checkEntity(name string) error {
+	if name == "-" {
+		return nil
+	}
+	return scaffold.CheckEntity(name)
+}
+
+func checkCI(provider string) error {
+	for _, p := range ciProviders {
+		if p == provider {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown CI provider %q, use one of %s", provider, strings.Join(ciProviders, ", "))
+}
+
+// containsProtos сообщает, есть ли в директории proto файлы
+func containsProtos(dir string) (bool, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.proto"))
+	if err != nil {
+		return false, fmt.Errorf("failed to list proto files: %w", err)
+	}
+	return len(matches) > 0, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"generator/internal/generator"
+)
+
+// runLint проверяет исходные proto до генерации и печатает замечания
+// в формате file:line:col. Команда завершается ошибкой, если есть
+// замечания уровня error, а с -strict - любые.
+func runLint(args []string) error {
+	flags, configPath := newFlagSet("lint")
+	format := flags.String("format", "text", "Output format: text or json")
+	strict := flags.Bool("strict", false, "Fail on warnings as well as errors")
+	rules := flags.Bool("rules", false, "List the lint rules and exit")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, use text or json", *format)
+	}
+	if *rules {
+		for _, r := range generator.LintRules {
+			fmt.Printf("%-16s %-8s %s\n", r.ID, r.Severity, r.Description)
+		}
+		return nil
+	}
+
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+	files, err := cfg.ProtoFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no proto files in %s", cfg.Proto.Source)
+	}
+	g, err := newGenerator(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	issues, err := g.Lint(files)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		if issues == nil {
+			issues = []generator.LintIssue{}
+		}
+		data, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode issues: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+	}
+
+	errs, warnings := 0, 0
+	for _, issue := range issues {
+		if issue.Severity == generator.SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	if errs > 0 || (*strict && warnings > 0) {
+		return fmt.Errorf("lint found %d errors and %d warnings", errs, warnings)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Команда appgen ведёт сервис от proto файлов до запущенного приложения:
+// создаёт проект, генерирует proto и Go код, применяет миграции, проверяет
+// и запускает сгенерированный сервис.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"generator/internal/config"
+	"generator/internal/logging"
+)
+
+// command - подкоманда appgen
+type command struct {
+	name  string
+	usage string
+	short string
+	run   func(args []string) error
+}
+
+var commands []command
+
+// logOptions - флаги журнала, общие для всех подкоманд
+var logOptions struct {
+	quiet   bool
+	verbose bool
+	format  string
+}
+
+// logger - журнал appgen и генератора, его настраивает parseFlags
+var logger = slog.Default()
+
+func init() {
+	// Список заполняется здесь, потому что help ссылается на commands
+	commands = []command{
+		{name: "init", usage: "[flags] [dir]", short: "create a new project: config, proto directory and sample entity", run: runInit},
+		{name: "proto", usage: "[flags]", short: "generate service protos and compile them to Go", run: runProto},
+		{name: "generate", usage: "[flags]", short: "generate protos, Go code and tidy the module", run: runGenerate},
+		{name: "add", usage: "entity [flags] <Name> [field:type[:required]...]", short: "add an entity proto and regenerate the service", run: runAdd},
+		{name: "migrate", usage: "[flags] [up|down|status|reset]", short: "apply or inspect database migrations", run: runMigrate},
+		{name: "run", usage: "[flags]", short: "build and start the generated service", run: runRun},
+		{name: "lint", usage: "[flags]", short: "check source protos for mistakes before generating", run: runLint},
+		{name: "breaking", usage: "-against <git-ref|snapshot> [flags]", short: "report breaking API and schema changes against an earlier revision", run: runBreaking},
+		{name: "graph", usage: "[flags]", short: "export the model and reference graph as DOT, Mermaid or JSON", run: runGraph},
+		{name: "check", usage: "[flags]", short: "build and vet the generated service", run: runCheck},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "appgen %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "appgen: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: appgen <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'appgen <command> -h' for command flags.\n")
+}
+
+// newFlagSet создаёт набор флагов подкоманды с общим флагом -config
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("appgen "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: appgen %s %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.usage, capitalize(cmd.short))
+			}
+		}
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", config.FileName, "Project configuration file")
+	fs.BoolVar(&logOptions.quiet, "q", false, "Print only warnings and errors")
+	fs.BoolVar(&logOptions.verbose, "v", false, "Print debug messages and every changed file")
+	fs.StringVar(&logOptions.format, "log-format", "text", "Log format: text or json")
+	return fs, configPath
+}
+
+// parseFlags разбирает флаги подкоманды и настраивает журнал: -q оставляет
+// предупреждения и ошибки, -v добавляет отладочные сообщения генератора
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	l, err := logging.New(logOptions.quiet, logOptions.verbose, logOptions.format)
+	if err != nil {
+		return err
+	}
+	logger = l
+	slog.SetDefault(logger)
+	return nil
+}
+
+// loadConfig читает файл настроек. Файл по умолчанию необязателен, а
+// указанный явно через -config должен существовать.
+func loadConfig(fs *flag.FlagSet, path string) (*config.Config, error) {
+	load := config.LoadOptional
+	if isSet(fs, "config") {
+		load = config.Load
+	}
+	return load(path)
+}
+
+// isSet сообщает, задан ли флаг в командной строке
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// step сообщает об очередном шаге: заголовком в консоль, а при
+// -log-format=json - записью журнала. С -q шаги не выводятся.
+func step(format string, args ...interface{}) {
+	switch {
+	case logOptions.format == "json":
+		logger.Info(fmt.Sprintf(format, args...))
+	case !logOptions.quiet:
+		fmt.Printf("==> "+format+"\n", args...)
+	}
+}
+
+// goCommand запускает команду go в директории dir с выводом в консоль
+func goCommand(dir string, args ...string) error {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
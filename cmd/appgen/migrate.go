@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+
+	"generator/internal/config"
+)
+
+// runMigrate применяет миграции сервиса. reset откатывает все миграции и
+// выполняется только с -force.
+func runMigrate(args []string) error {
+	flags, configPath := newFlagSet("migrate")
+	dsn := flags.String("dsn", "", "Database connection string (built from DB_* variables of the service .env by default)")
+	wait := flags.Duration("wait", 30*time.Second, "How long to wait for the database to accept connections")
+	force := flags.Bool("force", false, "Allow reset, which rolls back every applied migration")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("too many arguments")
+	}
+
+	action := "up"
+	if flags.NArg() == 1 {
+		action = flags.Arg(0)
+	}
+	switch action {
+	case "up", "down", "status":
+	case "reset":
+		if !*force {
+			return fmt.Errorf("reset rolls back every applied migration and drops their tables, rerun with -force to confirm")
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return migrate(ctx, cfg, *dsn, action, *wait)
+}
+
+// migrate выполняет действие над миграциями из <output>/migrations
+func migrate(ctx context.Context, cfg *config.Config, dsn, action string, wait time.Duration) error {
+	if dsn == "" {
+		var err error
+		if dsn, err = databaseURL(cfg.Output.Dir); err != nil {
+			return err
+		}
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	step("Waiting for the database")
+	if err := waitForDB(ctx, db, wait); err != nil {
+		return err
+	}
+
+	migrations := os.DirFS(filepath.Join(cfg.Output.Dir, "migrations"))
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	defer provider.Close()
+
+	switch action {
+	case "up":
+		step("Applying migrations")
+		results, err := provider.Up(ctx)
+		var partial *goose.PartialError
+		if errors.As(err, &partial) {
+			results = partial.Applied
+		}
+		printResults(results)
+		if err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+	case "down":
+		step("Rolling back the last migration")
+		result, err := provider.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Println("No applied migrations")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to roll back migration: %w", err)
+		}
+		printResults([]*goose.MigrationResult{result})
+
+	case "reset":
+		step("Rolling back all migrations")
+		results, err := provider.DownTo(ctx, 0)
+		var partial *goose.PartialError
+		if errors.As(err, &partial) {
+			results = partial.Applied
+		}
+		printResults(results)
+		if err != nil {
+			return fmt.Errorf("failed to roll back migrations: %w", err)
+		}
+
+	case "status":
+		step("Migration status")
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read migration status: %w", err)
+		}
+		for _, s := range statuses {
+			applied := ""
+			if s.State == goose.StateApplied {
+				applied = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Printf("  %-8s %-19s %s\n", s.State, applied, filepath.Base(s.Source.Path))
+		}
+	}
+	return nil
+}
+
+func printResults(results []*goose.MigrationResult) {
+	for _, r := range results {
+		fmt.Printf("  %s\n", r)
+	}
+}
+
+// waitForDB ждёт, пока база данных начнёт принимать соединения
+func waitForDB(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database is not reachable: %w", err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// databaseURL собирает строку подключения из переменных DB_* так же, как
+// сгенерированный сервис: переменные окружения перекрывают .env
+func databaseURL(dir string) (string, error) {
+	env, err := godotenv.Read(filepath.Join(dir, ".env"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read .env: %w", err)
+	}
+
+	lookup := func(name string) string {
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		return env[name]
+	}
+
+	names := []string{"DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME"}
+	values := make(map[string]string, len(names))
+	var missing []string
+	for _, name := range names {
+		values[name] = lookup(name)
+		if values[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("database settings %s are not set in the environment or %s",
+			strings.Join(missing, ", "), filepath.Join(dir, ".env"))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(values["DB_USER"], values["DB_PASSWORD"]),
+		Host:     net.JoinHostPort(values["DB_HOST"], values["DB_PORT"]),
+		Path:     "/" + values["DB_NAME"],
+		RawQuery: "sslmode=disable",
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prompter задаёт вопросы мастера init
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter() *prompter {
+	return &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+}
+
+// ask спрашивает строку. Пустой ответ означает значение по умолчанию,
+// неверный ответ переспрашивается.
+func (p *prompter) ask(question, def string, check func(string) error) (string, error) {
+	for {
+		answer, err := p.readLine(question, def)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		if check != nil {
+			if err := check(answer); err != nil {
+				fmt.Fprintf(p.out, "  %v\n", err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+// confirm спрашивает да или нет
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := p.readLine(question, hint)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintf(p.out, "  answer y or n\n")
+	}
+}
+
+func (p *prompter) readLine(question, hint string) (string, error) {
+	fmt.Fprintf(p.out, "%s [%s]: ", question, hint)
+	line, err := p.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// isTerminal сообщает, подключён ли файл к терминалу
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
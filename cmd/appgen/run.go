@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// runRun собирает сервис и запускает его в выходной директории, чтобы
+// сервис нашёл свой .env. Сигналы завершения передаются сервису.
+func runRun(args []string) error {
+	flags, configPath := newFlagSet("run")
+	migrateFirst := flags.Bool("migrate", false, "Apply pending migrations before starting the service")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(flags, *configPath)
+	if err != nil {
+		return err
+	}
+
+	if *migrateFirst {
+		if err := migrate(context.Background(), cfg, "", "up", 30*time.Second); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.MkdirTemp("", "appgen-run-")
+	if err != nil {
+		return fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	step("Building service")
+	bin, err := buildServer(cfg.Output.Dir, tmp, "app")
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	step("Starting service, press Ctrl+C to stop")
+	srv, err := startServer(cfg.Output.Dir, bin)
+	if err != nil {
+		return err
+	}
+
+	stopped := false
+	for {
+		select {
+		case sig := <-signals:
+			stopped = true
+			_ = srv.cmd.Process.Signal(sig)
+		case err := <-srv.done:
+			if err != nil && !stopped {
+				return fmt.Errorf("service exited: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// buildServer собирает сервис из dir в бинарный файл name в директории tmp
+func buildServer(dir, tmp, name string) (string, error) {
+	bin := filepath.Join(tmp, name)
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	if err := goCommand(dir, "build", "-o", bin, "./cmd/app"); err != nil {
+		return "", err
+	}
+	return bin, nil
+}
+
+// server - запущенный сервис
+type server struct {
+	cmd *exec.Cmd
+	// done получает результат завершения процесса
+	done chan error
+}
+
+// startServer запускает собранный сервис в директории dir, чтобы он нашёл
+// свой .env
+func startServer(dir, bin string) (*server, error) {
+	cmd := exec.Command(bin)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start service: %w", err)
+	}
+
+	s := &server{cmd: cmd, done: make(chan error, 1)}
+	go func() { s.done <- cmd.Wait() }()
+	return s, nil
+}
+
+// stop просит сервис завершиться и через timeout завершает его принудительно
+func (s *server) stop(timeout time.Duration) {
+	if err := s.cmd.Process.Signal(os.Interrupt); err != nil {
+		// Процесс уже завершился или сигнал не поддерживается (Windows)
+		_ = s.cmd.Process.Kill()
+	}
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		_ = s.cmd.Process.Kill()
+		<-s.done
+	}
+}
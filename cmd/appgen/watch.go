@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"generator/internal/config"
+	"generator/internal/generator"
+	"generator/internal/outfs"
+)
+
+// stopTimeout - сколько ждать завершения сервиса перед принудительной остановкой
+const stopTimeout = 5 * time.Second
+
+// watcher перегенерирует проект при изменении исходных proto, файла
+// настроек и переопределённых шаблонов. Изменения proto перегенерируют
+// только модели с изменившимся описанием, изменения настроек и шаблонов -
+// весь проект.
+type watcher struct {
+	configPath string
+	load       func() (*config.Config, error)
+	debounce   time.Duration
+	tidy       bool
+	verify     bool
+	restart    bool
+
+	cfg *config.Config
+	gen *generator.Generator
+	fs  *fsnotify.Watcher
+	// tmp - директория бинарных файлов сервиса, builds - число сборок
+	tmp    string
+	builds int
+	srv    *server
+}
+
+// run генерирует проект и перегенерирует его после каждой серии
+// изменений, пока не придёт сигнал завершения. Ошибки генерации
+// печатаются, наблюдение продолжается.
+func (w *watcher) run(ctx context.Context) error {
+	var err error
+	w.fs, err = fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching files: %w", err)
+	}
+	defer w.fs.Close()
+
+	if w.restart {
+		w.tmp, err = os.MkdirTemp("", "appgen-watch-")
+		if err != nil {
+			return fmt.Errorf("failed to create build directory: %w", err)
+		}
+		defer os.RemoveAll(w.tmp)
+	}
+	defer func() {
+		if w.srv != nil {
+			w.srv.stop(stopTimeout)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// Без настроек нечего наблюдать, поэтому ошибка первой загрузки фатальна
+	if err := w.reload(); err != nil {
+		return err
+	}
+	w.regenerate(ctx, nil)
+
+	var (
+		timer   *time.Timer
+		fire    <-chan time.Time
+		full    bool
+		changed = make(map[string]bool)
+	)
+	for {
+		var done <-chan error
+		if w.srv != nil {
+			done = w.srv.done
+		}
+
+		select {
+		case <-signals:
+			step("Stopping")
+			return nil
+
+		case err := <-done:
+			w.srv = nil
+			if err != nil {
+				logger.Warn("service exited", "error", err)
+			} else {
+				step("Service exited")
+			}
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error("watch error", "error", err)
+
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			w.watchCreated(event)
+			kind := w.classify(event)
+			if kind == changeNone {
+				continue
+			}
+			full = full || kind == changeFull
+			changed[event.Name] = true
+			if timer == nil {
+				timer = time.NewTimer(w.debounce)
+			} else {
+				timer.Reset(w.debounce)
+			}
+			fire = timer.C
+
+		case <-fire:
+			fire = nil
+			if full {
+				if err := w.reload(); err != nil {
+					logger.Error("failed to reload the configuration", "error", err)
+					full = false
+					changed = make(map[string]bool)
+					continue
+				}
+			}
+			w.regenerate(ctx, changed)
+			full = false
+			changed = make(map[string]bool)
+		}
+	}
+}
+
+// reload перечитывает настройки, создаёт новый генератор и обновляет
+// список наблюдаемых директорий. При ошибке остаются прежние настройки.
+func (w *watcher) reload() error {
+	cfg, err := w.load()
+	if err != nil {
+		return err
+	}
+	gen, err := newGenerator(cfg, true)
+	if err != nil {
+		return err
+	}
+	w.cfg, w.gen = cfg, gen
+
+	for _, path := range w.fs.WatchList() {
+		_ = w.fs.Remove(path)
+	}
+	// Директорию настроек достаточно наблюдать без поддиректорий: редакторы
+	// сохраняют файл через переименование, и событие приходит от директории
+	if err := w.fs.Add(filepath.Dir(w.configPath)); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", w.configPath, err)
+	}
+	dirs := w.cfg.ImportPaths()
+	if w.cfg.Output.Templates != "" {
+		dirs = append(dirs, w.cfg.Output.Templates)
+	}
+	for _, dir := range dirs {
+		if err := w.watchTree(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchTree наблюдает за директорией и её поддиректориями
+func (w *watcher) watchTree(root string) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		// Выходная директория может лежать внутри наблюдаемой, её файлы пишет сам генератор
+		if path != root && (within(path, w.cfg.Output.Dir) || strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		return w.fs.Add(path)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", root, err)
+	}
+	return nil
+}
+
+// watchCreated добавляет в наблюдение новые поддиректории proto и шаблонов
+func (w *watcher) watchCreated(event fsnotify.Event) {
+	if !event.Has(fsnotify.Create) || samePath(event.Name, w.configPath) {
+		return
+	}
+	inTemplates := w.cfg.Output.Templates != "" && within(event.Name, w.cfg.Output.Templates)
+	if !inTemplates && !w.inSources(event.Name) {
+		return
+	}
+	if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+		if err := w.watchTree(event.Name); err != nil {
+			logger.Error("watch error", "error", err)
+		}
+	}
+}
+
+type changeKind int
+
+const (
+	changeNone changeKind = iota
+	// changeModels - изменились proto, перегенерируются изменённые модели
+	changeModels
+	// changeFull - изменились настройки или шаблоны, перегенерируется всё
+	changeFull
+)
+
+// classify определяет, что нужно перегенерировать после события
+func (w *watcher) classify(event fsnotify.Event) changeKind {
+	if event.Op == fsnotify.Chmod {
+		return changeNone
+	}
+	return w.classifyPath(event.Name)
+}
+
+func (w *watcher) classifyPath(path string) changeKind {
+	switch {
+	case samePath(path, w.configPath):
+		return changeFull
+	case w.cfg.Output.Templates != "" && within(path, w.cfg.Output.Templates):
+		return changeFull
+	case filepath.Ext(path) == ".proto" && w.inSources(path):
+		return changeModels
+	}
+	return changeNone
+}
+
+// inSources сообщает, лежит ли путь в директориях исходных proto
+func (w *watcher) inSources(path string) bool {
+	if within(path, w.cfg.Output.Dir) {
+		return false
+	}
+	for _, dir := range w.cfg.ImportPaths() {
+		if within(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// regenerate генерирует proto и код, печатает изменения и перезапускает
+// сервис. changed - изменённые файлы, nil для первого запуска.
+func (w *watcher) regenerate(ctx context.Context, changed map[string]bool) {
+	start := time.Now()
+	if changed != nil {
+		paths := make([]string, 0, len(changed))
+		for path := range changed {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		step("Changed %s", strings.Join(paths, ", "))
+	}
+
+	if err := w.generate(ctx); err != nil {
+		logger.Error("generation failed", "error", err)
+		step("Waiting for changes")
+		return
+	}
+	step("Done in %s, waiting for changes", time.Since(start).Round(time.Millisecond))
+}
+
+func (w *watcher) generate(ctx context.Context) error {
+	if err := buildProto(ctx, w.cfg); err != nil {
+		return err
+	}
+
+	files, err := w.cfg.ProtoFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no proto files in %s", w.cfg.Proto.Source)
+	}
+
+	step("Generating code into %s", w.cfg.Output.Dir)
+	if err := w.gen.Generate(ctx, files, outfs.NewOS(w.cfg.Output.Dir)); err != nil {
+		return fmt.Errorf("failed to generate code: %w", err)
+	}
+	summary := w.gen.Summary()
+	printSummary(summary, 20)
+
+	if w.tidy && touches(summary.Changes, "go.mod") {
+		step("Tidying %s/go.mod", w.cfg.Output.Dir)
+		if err := goCommand(w.cfg.Output.Dir, "mod", "tidy"); err != nil {
+			return err
+		}
+	}
+	if w.verify {
+		if err := verifyCode(ctx, w.cfg); err != nil {
+			return err
+		}
+	}
+
+	if w.restart {
+		return w.restartServer()
+	}
+	return nil
+}
+
+// restartServer собирает сервис и заменяет им запущенный. Если сборка не
+// удалась, прежний сервис продолжает работать.
+func (w *watcher) restartServer() error {
+	step("Building service")
+	w.builds++
+	bin, err := buildServer(w.cfg.Output.Dir, w.tmp, fmt.Sprintf("app-%d", w.builds))
+	if err != nil {
+		return err
+	}
+
+	if w.srv != nil {
+		step("Restarting service")
+		w.srv.stop(stopTimeout)
+		_ = os.Remove(w.srv.cmd.Path)
+	} else {
+		step("Starting service")
+	}
+	w.srv, err = startServer(w.cfg.Output.Dir, bin)
+	return err
+}
+
+// touches сообщает, затронул ли запуск генератора файл path
+func touches(changes []generator.Change, path string) bool {
+	for _, c := range changes {
+		if c.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// within сообщает, лежит ли path внутри dir или совпадает с ней
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(absPath(dir), absPath(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func samePath(a, b string) bool {
+	return absPath(a) == absPath(b)
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
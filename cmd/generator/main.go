@@ -3,48 +3,145 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"path/filepath"
 	"strings"
 
+	"generator/internal/config"
 	"generator/internal/generator"
+	"generator/internal/logging"
+	"generator/internal/modpath"
 )
 
 func main() {
-	protoPath := flag.String("proto", "", "Path to proto files (supports comma-separated list or glob pattern)")
+	if err := run(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	configPath := flag.String("config", config.FileName, "Project configuration file")
+	protoPath := flag.String("proto", "", "Path to proto files (supports comma-separated list or glob pattern), overrides proto.source")
 	outputDir := flag.String("output", "out", "Output directory")
+	templatesDir := flag.String("templates", "", "Directory with templates overriding the built-in ones")
+	upgrade := flag.Bool("upgrade", false, "Three-way merge new templates into already customised files")
+	legacyEntities := flag.Bool("legacy-entities", false, "Treat every message except *Request/*Response as an entity instead of using (appgen.entity)")
+	modulePath := flag.String("module", modpath.Default, "Go module path of the generated service")
+	quiet := flag.Bool("q", false, "Print only warnings and errors")
+	verbose := flag.Bool("v", false, "Print debug messages and every changed file")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
 	flag.Parse()
 
-	if *protoPath == "" {
-		flag.Usage()
-		return
+	logger, err := logging.New(*quiet, *verbose, *logFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	// Флаги, заданные явно, перекрывают значения из файла настроек
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	load := config.LoadOptional
+	if explicit["config"] {
+		load = config.Load
+	}
+	cfg, err := load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if explicit["output"] {
+		cfg.Output.Dir = *outputDir
+	}
+	if explicit["templates"] {
+		cfg.Output.Templates = *templatesDir
+	}
+	if explicit["legacy-entities"] {
+		cfg.LegacyEntities = *legacyEntities
+	}
+	if explicit["module"] {
+		cfg.Module = *modulePath
 	}
 
-	// Обрабатываем список файлов, разделенных запятыми
 	var protoFiles []string
-	if strings.Contains(*protoPath, ",") {
-		protoFiles = strings.Split(*protoPath, ",")
-		// Фильтруем пустые строки
-		var filteredFiles []string
-		for _, file := range protoFiles {
-			if file != "" {
-				filteredFiles = append(filteredFiles, file)
-			}
-		}
-		protoFiles = filteredFiles
+	if *protoPath != "" {
+		protoFiles, err = splitProtoPath(*protoPath)
 	} else {
-		// Если это не список через запятые, обрабатываем как glob
-		matches, err := filepath.Glob(*protoPath)
+		protoFiles, err = cfg.ProtoFiles()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find proto files: %w", err)
+	}
+	if len(protoFiles) == 0 {
+		flag.Usage()
+		return nil
+	}
+
+	logger.Info("processing proto files", "files", protoFiles)
+
+	opts, err := cfg.GeneratorOptions()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	opts.Logger = logger
+	g, err := generator.New(opts)
+	if err != nil {
+		return fmt.Errorf("failed to create generator: %w", err)
+	}
+
+	if *upgrade {
+		report, err := g.UpgradeFromProtoFiles(protoFiles, cfg.Output.Dir)
 		if err != nil {
-			log.Fatalf("Failed to parse glob pattern: %v", err)
+			return fmt.Errorf("failed to upgrade code: %w", err)
 		}
-		protoFiles = matches
+		report.Print(os.Stdout)
+		if len(report.Conflicts()) > 0 {
+			return fmt.Errorf("upgrade finished with conflicts, resolve the conflict markers and commit the result")
+		}
+		return nil
+	}
+
+	if err := g.GenerateFromProtoFiles(protoFiles, cfg.Output.Dir); err != nil {
+		return fmt.Errorf("failed to generate code: %w", err)
 	}
 
-	fmt.Printf("Processing proto files: %v\n", protoFiles)
+	s := g.Summary()
+	switch {
+	case *logFormat == "json":
+		logger.Info("summary",
+			"created", s.Paths(generator.ChangeCreated),
+			"updated", s.Paths(generator.ChangeUpdated),
+			"removed", s.Paths(generator.ChangeRemoved),
+			"models", s.Models,
+			"migrations", s.Migrations)
+	case *verbose:
+		s.Print(os.Stdout, -1)
+	case !*quiet:
+		s.Print(os.Stdout, 20)
+	}
+	return nil
+}
+
+// splitProtoPath разбирает значение -proto: список через запятую или glob
+func splitProtoPath(protoPath string) ([]string, error) {
+	// Обрабатываем список файлов, разделенных запятыми
+	if strings.Contains(protoPath, ",") {
+		var files []string
+		for _, file := range strings.Split(protoPath, ",") {
+			// Фильтруем пустые строки
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+		return files, nil
+	}
 
-	g := generator.New()
-	if err := g.GenerateFromProtoFiles(protoFiles, *outputDir); err != nil {
-		log.Fatalf("Failed to generate code: %v", err)
+	// Если это не список через запятые, обрабатываем как glob
+	matches, err := filepath.Glob(protoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse glob pattern: %w", err)
 	}
+	return matches, nil
 }
@@ -2,253 +2,67 @@ package main
 
 import (
 	"flag"
-	"fmt"
-	"io/ioutil"
 	"log"
-	"os"
-	"path/filepath"
-	"strings"
-	"text/template"
-)
-
-type ProtoGen struct {
-	sourceDir string
-	outputDir string
-}
-
-const commonProtoTemplate = `syntax = "proto3";
-
-package proto;
-
-option go_package = "app/internal/proto";
-
-// EmptyResponse message used for operations that don't return data
-message EmptyResponse {}`
-
-const serviceProtoTemplate = `syntax = "proto3";
-
-package proto;
-
-import "google/api/annotations.proto";
-import "common.proto";
-
-option go_package = "app/internal/proto";
-
-// {{.ServiceName}} message
-message {{.ServiceName}} {
-{{- range $line := .MessageFields}}
-  {{$line}}
-{{- end}}
-}
-
-// Create request
-message Create{{.ServiceName}}Request {
-  {{.ServiceName}} {{toLower .ServiceName}} = 1;
-}
-
-// Get request
-message Get{{.ServiceName}}Request {
-  int64 id = 1;
-}
 
-// List request
-message List{{.ServiceName}}Request {}
+	"google.golang.org/protobuf/reflect/protoreflect"
 
-// List response
-message List{{.ServiceName}}Response {
-  repeated {{.ServiceName}} items = 1;
-}
-
-// Update request
-message Update{{.ServiceName}}Request {
-  int64 id = 1;
-  {{.ServiceName}} {{toLower .ServiceName}} = 2;
-}
-
-// Delete request
-message Delete{{.ServiceName}}Request {
-  int64 id = 1;
-}
-
-// {{.ServiceName}} service definition
-service {{.ServiceName}}Service {
-  // Create a new {{.ServiceNameLower}}
-  rpc Create(Create{{.ServiceName}}Request) returns ({{.ServiceName}}) {
-    option (google.api.http) = {
-      post: "/api/v1/{{.ServiceNamePlural}}"
-      body: "{{toLower .ServiceName}}"
-    };
-  }
-
-  // Get {{.ServiceNameLower}} by ID
-  rpc Get(Get{{.ServiceName}}Request) returns ({{.ServiceName}}) {
-    option (google.api.http) = {
-      get: "/api/v1/{{.ServiceNamePlural}}/{id}"
-    };
-  }
-
-  // List all {{.ServiceNamePlural}}
-  rpc List(List{{.ServiceName}}Request) returns (List{{.ServiceName}}Response) {
-    option (google.api.http) = {
-      get: "/api/v1/{{.ServiceNamePlural}}"
-    };
-  }
-
-  // Update {{.ServiceNameLower}}
-  rpc Update(Update{{.ServiceName}}Request) returns ({{.ServiceName}}) {
-    option (google.api.http) = {
-      put: "/api/v1/{{.ServiceNamePlural}}/{id}"
-      body: "{{toLower .ServiceName}}"
-    };
-  }
+	"generator/internal/config"
+	"generator/internal/modpath"
+	"generator/internal/protogen"
+)
 
-  // Delete {{.ServiceNameLower}}
-  rpc Delete(Delete{{.ServiceName}}Request) returns (EmptyResponse) {
-    option (google.api.http) = {
-      delete: "/api/v1/{{.ServiceNamePlural}}/{id}"
-    };
-  }
-}`
+func main() {
+	configPath := flag.String("config", config.FileName, "Project configuration file")
+	sourceDir := flag.String("source", "proto", "Source directory containing proto files")
+	outputDir := flag.String("output", "out/internal/proto", "Output directory for generated proto files")
+	modulePath := flag.String("module", modpath.Default, "Go module path of the generated service")
+	protoPackage := flag.String("proto-package", "", "Proto package of the generated files (derived from -module by default)")
+	legacyEntities := flag.Bool("legacy-entities", false, "Treat every message except *Request/*Response as an entity instead of using (appgen.entity)")
+	flag.Parse()
 
-type ServiceData struct {
-	ServiceName       string
-	ServiceNameLower  string
-	ServiceNamePlural string
-	MessageFields     []string
-}
+	// Флаги, заданные явно, перекрывают значения из файла настроек
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
 
-func NewProtoGen(sourceDir, outputDir string) *ProtoGen {
-	return &ProtoGen{
-		sourceDir: sourceDir,
-		outputDir: outputDir,
+	load := config.LoadOptional
+	if explicit["config"] {
+		load = config.Load
 	}
-}
-
-func (g *ProtoGen) Generate() error {
-	// Create output directory
-	if err := os.MkdirAll(g.outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	cfg, err := load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
 	}
-
-	// Generate common.proto
-	if err := g.generateCommonProto(); err != nil {
-		return fmt.Errorf("failed to generate common.proto: %w", err)
+	if explicit["source"] {
+		cfg.Proto.Source = *sourceDir
 	}
-
-	// Process all proto files in source directory
-	files, err := filepath.Glob(filepath.Join(g.sourceDir, "*.proto"))
-	if err != nil {
-		return fmt.Errorf("failed to list proto files: %w", err)
+	if explicit["output"] {
+		cfg.Output.ProtoDir = *outputDir
 	}
-
-	for _, file := range files {
-		if err := g.generateServiceProto(file); err != nil {
-			return fmt.Errorf("failed to generate service proto for %s: %w", file, err)
-		}
+	if explicit["module"] {
+		cfg.Module = *modulePath
 	}
-
-	return nil
-}
-
-func (g *ProtoGen) generateCommonProto() error {
-	outPath := filepath.Join(g.outputDir, "common.proto")
-	return ioutil.WriteFile(outPath, []byte(commonProtoTemplate), 0644)
-}
-
-func (g *ProtoGen) generateServiceProto(sourcePath string) error {
-	// Read source file
-	content, err := ioutil.ReadFile(sourcePath)
-	if err != nil {
-		return fmt.Errorf("failed to read source file: %w", err)
+	if explicit["proto-package"] {
+		cfg.Proto.Package = *protoPackage
 	}
-
-	// Extract service name from filename
-	baseName := filepath.Base(sourcePath)
-	serviceName := strings.TrimSuffix(baseName, ".proto")
-	serviceName = strings.Title(serviceName)
-
-	// Extract message definition and clean it up
-	messageContent := string(content)
-	messageContent = strings.ReplaceAll(messageContent, "\r\n", "\n") // Normalize line endings
-	messageContent = strings.TrimSpace(messageContent)
-
-	// Format the message definition
-	var messageFields []string
-	lines := strings.Split(messageContent, "\n")
-	inMessage := false
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.Contains(line, "message") {
-			inMessage = true
-			continue
-		}
-		if line == "}" {
-			inMessage = false
-			continue
-		}
-		if inMessage && line != "" {
-			if !strings.Contains(line, "message") && !strings.Contains(line, "}") {
-				messageFields = append(messageFields, line)
-			}
-		}
+	if explicit["legacy-entities"] {
+		cfg.LegacyEntities = *legacyEntities
 	}
 
-	data := ServiceData{
-		ServiceName:       serviceName,
-		ServiceNameLower:  strings.ToLower(serviceName),
-		ServiceNamePlural: strings.ToLower(serviceName) + "s",
-		MessageFields:     messageFields,
+	if err := modpath.Check(cfg.Module); err != nil {
+		log.Fatal(err)
 	}
-
-	// Создаем шаблон с нашими вспомогательными функциями
-	tmpl := template.New("service")
-	tmpl = tmpl.Funcs(template.FuncMap{
-		"splitLines": splitLines,
-		"contains":   contains,
-		"trimPrefix": trimPrefix,
-		"toLower":    strings.ToLower,
-	})
-
-	// Парсим шаблон
-	tmpl, err = tmpl.Parse(serviceProtoTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+	if cfg.Proto.Package != "" && !protoreflect.FullName(cfg.Proto.Package).IsValid() {
+		log.Fatalf("invalid proto package %q", cfg.Proto.Package)
 	}
-
-	outPath := filepath.Join(g.outputDir, baseName)
-	outFile, err := os.Create(outPath)
+	overrides, err := cfg.Overrides()
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outFile.Close()
-
-	if err := tmpl.Execute(outFile, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	return nil
-}
-
-// Добавим вспомогательные функции для шаблона
-func splitLines(s string) []string {
-	return strings.Split(s, "\n")
-}
-
-func contains(s, substr string) bool {
-	return strings.Contains(s, substr)
-}
-
-// Добавляем новую вспомогательную функцию для шаблона
-func trimPrefix(s string, prefix string) string {
-	return strings.TrimPrefix(s, prefix)
-}
-
-func main() {
-	sourceDir := flag.String("source", "proto", "Source directory containing proto files")
-	outputDir := flag.String("output", "out/internal/proto", "Output directory for generated proto files")
-	flag.Parse()
-
-	generator := NewProtoGen(*sourceDir, *outputDir)
+	generator := protogen.NewProtoGen(cfg.Proto.Source, cfg.ProtoDir(), cfg.Module, cfg.Proto.Package)
+	generator.SetImportPaths(cfg.Proto.ImportPaths)
+	generator.SetOverrides(overrides)
+	generator.SetLegacyEntities(cfg.LegacyEntities)
 	if err := generator.Generate(); err != nil {
 		log.Fatalf("Failed to generate proto files: %v", err)
 	}
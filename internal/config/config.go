@@ -0,0 +1,355 @@
+// Package config читает файл настроек проекта appgen.yaml. Файл описывает
+// исходные proto, путь модуля, раскладку выходной директории, включённые
+// части проекта, базу данных и параметры отдельных сообщений. Формат
+// версионирован и проверяется по JSON Schema (schema.json).
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"gopkg.in/yaml.v3"
+
+	"generator/internal/generator"
+	"generator/internal/modpath"
+	"generator/internal/protoload"
+)
+
+// FileName - имя файла настроек в корне проекта
+const FileName = "appgen.yaml"
+
+// Version - текущая версия формата
+const Version = 1
+
+//go:embed schema.json
+var schemaJSON []byte
+
+// schemaURL - имя, под которым схема регистрируется в валидаторе
+const schemaURL = "urn:appgen:config:v1"
+
+// Schema возвращает JSON Schema файла настроек
+func Schema() []byte {
+	return schemaJSON
+}
+
+// Config - настройки проекта
+type Config struct {
+	Version        int                `yaml:"version"`
+	Module         string             `yaml:"module"`
+	Proto          Proto              `yaml:"proto"`
+	Output         Output             `yaml:"output"`
+	Go             Go                 `yaml:"go"`
+	Server         Server             `yaml:"server"`
+	Database       Database           `yaml:"database"`
+	Features       Features           `yaml:"features"`
+	LegacyEntities bool               `yaml:"legacy_entities"`
+	Messages       map[string]Message `yaml:"messages"`
+	Plugins        []Plugin           `yaml:"plugins"`
+}
+
+// Proto - исходные proto файлы
+type Proto struct {
+	// Source - директория, все *.proto из которой идут в генерацию
+	Source string `yaml:"source"`
+	// ImportPaths - дополнительные директории для импортов
+	ImportPaths []string `yaml:"import_paths"`
+	// Package - proto пакет выходных файлов, по умолчанию выводится из module
+	Package string `yaml:"package"`
+}
+
+// Output - раскладка выходной директории
+type Output struct {
+	Dir string `yaml:"dir"`
+	// ProtoDir - директория выходных proto, по умолчанию <dir>/internal/proto
+	ProtoDir string `yaml:"proto_dir"`
+	// Templates - директория с шаблонами, переопределяющими встроенные
+	Templates string `yaml:"templates"`
+}
+
+// Go - версия Go генерируемого проекта
+type Go struct {
+	Version string `yaml:"version"`
+}
+
+// Server - порты сервиса по умолчанию
+type Server struct {
+	HTTPPort int `yaml:"http_port"`
+	GRPCPort int `yaml:"grpc_port"`
+}
+
+// Database - база данных сервиса
+type Database struct {
+	Dialect string `yaml:"dialect"`
+	Version string `yaml:"version"`
+}
+
+// Features - необязательные части проекта, см. generator.Features
+type Features struct {
+	Gateway bool   `yaml:"gateway"`
+	Tests   bool   `yaml:"tests"`
+	Docker  bool   `yaml:"docker"`
+	CI      string `yaml:"ci"`
+}
+
+// Message - параметры сообщения, перекрывающие опции appgen в proto
+type Message struct {
+	Table    string `yaml:"table"`
+	Resource string `yaml:"resource"`
+	Entity   *bool  `yaml:"entity"`
+	// Methods - стандартные методы (CREATE, BATCH_GET, ...) вместо (appgen.api)
+	Methods []string `yaml:"methods"`
+}
+
+// Plugin - внешний плагин генератора, см. generator.ExecPlugin
+type Plugin struct {
+	Name string `yaml:"name"`
+	// Command - исполняемый файл и аргументы. Путь с / считается от
+	// директории файла настроек.
+	Command []string          `yaml:"command"`
+	Options map[string]string `yaml:"options"`
+}
+
+// Default возвращает настройки по умолчанию: они же действуют для
+// параметров, не указанных в файле
+func Default() *Config {
+	project := generator.DefaultProject()
+	return &Config{
+		Version: Version,
+		Module:  modpath.Default,
+		Proto:   Proto{Source: "proto"},
+		Output:  Output{Dir: "out"},
+		Go:      Go{Version: project.GoVersion},
+		Server: Server{
+			HTTPPort: project.HTTPPort,
+			GRPCPort: project.GRPCPort,
+		},
+		Database: Database{
+			Dialect: project.Database.Dialect,
+			Version: project.Database.Version,
+		},
+		Features: Features{
+			Gateway: project.Features.Gateway,
+			Tests:   project.Features.Tests,
+			Docker:  project.Features.Docker,
+			CI:      project.Features.CI,
+		},
+	}
+}
+
+// Load читает и проверяет файл настроек. Относительные пути в файле
+// считаются от его директории.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.resolvePaths(filepath.Dir(path))
+	return cfg, nil
+}
+
+// LoadOptional читает файл настроек, если он существует, иначе
+// возвращает настройки по умолчанию
+func LoadOptional(path string) (*Config, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return Default(), nil
+	}
+	return Load(path)
+}
+
+// Parse разбирает и проверяет содержимое файла настроек
+func Parse(data []byte) (*Config, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	if err := validate(doc); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	if err := modpath.Check(cfg.Module); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Overrides(); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(cfg.Plugins))
+	for _, p := range cfg.Plugins {
+		if seen[p.Name] {
+			return nil, fmt.Errorf("plugins: duplicate plugin %s", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return cfg, nil
+}
+
+// validate проверяет документ по JSON Schema. Документ сначала переводится
+// в JSON, чтобы числа и ключи имели те же типы, что ожидает валидатор.
+func validate(doc interface{}) error {
+	schemaDoc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaJSON))
+	if err != nil {
+		return fmt.Errorf("failed to parse config schema: %w", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaURL, schemaDoc); err != nil {
+		return fmt.Errorf("failed to load config schema: %w", err)
+	}
+	schema, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return fmt.Errorf("failed to compile config schema: %w", err)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to convert config: %w", err)
+	}
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to convert config: %w", err)
+	}
+
+	if err := schema.Validate(value); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+func (c *Config) resolvePaths(dir string) {
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+
+	resolve(&c.Proto.Source)
+	for i := range c.Proto.ImportPaths {
+		resolve(&c.Proto.ImportPaths[i])
+	}
+	resolve(&c.Output.Dir)
+	resolve(&c.Output.ProtoDir)
+	resolve(&c.Output.Templates)
+	for i := range c.Plugins {
+		if strings.Contains(c.Plugins[i].Command[0], "/") {
+			resolve(&c.Plugins[i].Command[0])
+		}
+	}
+}
+
+// ProtoFiles возвращает исходные proto файлы из Proto.Source
+func (c *Config) ProtoFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(c.Proto.Source, "*.proto"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list proto files: %w", err)
+	}
+	return files, nil
+}
+
+// ImportPaths возвращает директории для импортов: Proto.Source и Proto.ImportPaths
+func (c *Config) ImportPaths() []string {
+	return append([]string{c.Proto.Source}, c.Proto.ImportPaths...)
+}
+
+// ProtoDir возвращает директорию выходных proto файлов
+func (c *Config) ProtoDir() string {
+	if c.Output.ProtoDir != "" {
+		return c.Output.ProtoDir
+	}
+	return filepath.Join(c.Output.Dir, "internal", "proto")
+}
+
+// Project возвращает параметры генерируемого проекта
+func (c *Config) Project() generator.Project {
+	return generator.Project{
+		GoVersion: c.Go.Version,
+		HTTPPort:  c.Server.HTTPPort,
+		GRPCPort:  c.Server.GRPCPort,
+		Database: generator.Database{
+			Dialect: c.Database.Dialect,
+			Version: c.Database.Version,
+		},
+		Features: generator.Features{
+			Gateway: c.Features.Gateway,
+			Tests:   c.Features.Tests,
+			Docker:  c.Features.Docker,
+			CI:      c.Features.CI,
+		},
+	}
+}
+
+// Overrides возвращает параметры сообщений в виде, понятном protoload
+func (c *Config) Overrides() (map[string]protoload.Override, error) {
+	overrides := make(map[string]protoload.Override, len(c.Messages))
+	for name, m := range c.Messages {
+		o := protoload.Override{
+			Table:    m.Table,
+			Resource: m.Resource,
+			Entity:   m.Entity,
+		}
+		if m.Methods != nil {
+			o.Methods = []protoload.Method{}
+			for _, methodName := range m.Methods {
+				method, err := protoload.ParseMethod(methodName)
+				if err != nil {
+					return nil, fmt.Errorf("messages.%s: %w", name, err)
+				}
+				o.Methods = append(o.Methods, method)
+			}
+		}
+		overrides[name] = o
+	}
+	return overrides, nil
+}
+
+// GeneratorOptions возвращает настройки генератора кода
+func (c *Config) GeneratorOptions() (generator.Options, error) {
+	overrides, err := c.Overrides()
+	if err != nil {
+		return generator.Options{}, err
+	}
+	project := c.Project()
+	return generator.Options{
+		TemplatesDir:   c.Output.Templates,
+		LegacyEntities: c.LegacyEntities,
+		Module:         c.Module,
+		ProtoPackage:   c.Proto.Package,
+		ImportPaths:    c.ImportPaths(),
+		Overrides:      overrides,
+		Project:        &project,
+		Plugins:        c.GeneratorPlugins(),
+	}, nil
+}
+
+// GeneratorPlugins возвращает внешние плагины из настроек
+func (c *Config) GeneratorPlugins() []generator.Plugin {
+	plugins := make([]generator.Plugin, len(c.Plugins))
+	for i, p := range c.Plugins {
+		plugins[i] = &generator.ExecPlugin{
+			PluginName: p.Name,
+			Command:    p.Command,
+			Options:    p.Options,
+		}
+	}
+	return plugins
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		// check проверяет разобранные настройки
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "version only gives defaults",
+			data: "version: 1\n",
+			check: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg, Default()) {
+					t.Errorf("cfg = %+v, want defaults %+v", cfg, Default())
+				}
+			},
+		},
+		{
+			name: "unset values keep defaults",
+			data: "version: 1\nmodule: example.com/shop\nserver:\n  grpc_port: 9090\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Module != "example.com/shop" || cfg.Server.GRPCPort != 9090 {
+					t.Errorf("module = %q, grpc port = %d", cfg.Module, cfg.Server.GRPCPort)
+				}
+				if cfg.Server.HTTPPort != Default().Server.HTTPPort || cfg.Proto.Source != "proto" {
+					t.Errorf("http port = %d, proto source = %q, want defaults", cfg.Server.HTTPPort, cfg.Proto.Source)
+				}
+			},
+		},
+		{
+			name: "message overrides",
+			data: "version: 1\nmessages:\n  Courier:\n    table: riders\n    entity: false\n    methods: [GET, LIST]\n",
+			check: func(t *testing.T, cfg *Config) {
+				overrides, err := cfg.Overrides()
+				if err != nil {
+					t.Fatal(err)
+				}
+				o := overrides["Courier"]
+				if o.Table != "riders" || o.Entity == nil || *o.Entity || len(o.Methods) != 2 {
+					t.Errorf("override = %+v", o)
+				}
+			},
+		},
+		{name: "empty file", data: "", wantErr: true},
+		{name: "invalid yaml", data: "module: [", wantErr: true},
+		{name: "unknown key", data: "version: 1\nmodul: example.com/shop\n", wantErr: true},
+		{name: "wrong type", data: "version: 1\nserver:\n  http_port: http\n", wantErr: true},
+		{name: "unsupported version", data: "version: 2\n", wantErr: true},
+		{name: "invalid module path", data: "version: 1\nmodule: /shop\n", wantErr: true},
+		{name: "unknown method", data: "version: 1\nmessages:\n  Courier:\n    methods: [PATCH]\n", wantErr: true},
+		{
+			name:    "duplicate plugin",
+			data:    "version: 1\nplugins:\n  - name: docs\n    command: [docs]\n  - name: docs\n    command: [docs2]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse() = %+v, want error", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadResolvesPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	data := "version: 1\nproto:\n  source: api\n  import_paths: [/usr/include, third_party]\noutput:\n  dir: gen\n" +
+		"plugins:\n  - name: docs\n    command: [./bin/docs, -v]\n  - name: lint\n    command: [buf]\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"proto source", cfg.Proto.Source, filepath.Join(dir, "api")},
+		{"absolute import path", cfg.Proto.ImportPaths[0], "/usr/include"},
+		{"relative import path", cfg.Proto.ImportPaths[1], filepath.Join(dir, "third_party")},
+		{"output dir", cfg.Output.Dir, filepath.Join(dir, "gen")},
+		{"proto dir", cfg.ProtoDir(), filepath.Join(dir, "gen", "internal", "proto")},
+		{"plugin path", cfg.Plugins[0].Command[0], filepath.Join(dir, "bin", "docs")},
+		{"plugin from PATH", cfg.Plugins[1].Command[0], "buf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadOptional(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := LoadOptional(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatalf("LoadOptional() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("missing file: cfg = %+v, want defaults", cfg)
+	}
+
+	if _, err := Load(filepath.Join(dir, FileName)); err == nil {
+		t.Errorf("Load() of a missing file error = nil, want error")
+	}
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	cfg := Default()
+	cfg.Module = "example.com/shop"
+	cfg.Proto.Package = "shop.v1"
+	cfg.Features.CI = "github"
+
+	data, err := cfg.Render()
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse(Render()) error = %v\n%s", err, data)
+	}
+	if parsed.Module != cfg.Module || parsed.Proto.Package != cfg.Proto.Package || parsed.Features.CI != cfg.Features.CI {
+		t.Errorf("round trip = %+v, want %+v", parsed, cfg)
+	}
+}
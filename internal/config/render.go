@@ -0,0 +1,43 @@
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+//go:embed appgen.yaml.tmpl
+var fileTemplate string
+
+// Render возвращает содержимое файла настроек с комментариями. Пути
+// записываются как есть, поэтому для нового файла их задают относительными.
+func (c *Config) Render() ([]byte, error) {
+	tmpl, err := template.New(FileName).Funcs(template.FuncMap{
+		"quote": quote,
+	}).Parse(fileTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, c); err != nil {
+		return nil, fmt.Errorf("failed to render config: %w", err)
+	}
+
+	// Результат должен читаться обратно тем же Parse
+	if _, err := Parse(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("rendered config is invalid: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// quote записывает строку в кавычках: JSON строка является и YAML строкой
+func quote(s string) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
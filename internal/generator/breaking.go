@@ -0,0 +1,322 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BreakingChange - изменение между двумя снимками схемы, которое ломает
+// существующих клиентов или данные
+type BreakingChange struct {
+	Rule string `json:"rule"`
+	// Kind - proto для API и wire формата, schema для базы данных
+	Kind string `json:"kind"`
+	// Subject - изменившийся элемент: shop.v1.Courier.phone, couriers.phone
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+	// Breaking - изменение несовместимо с клиентами или данными прошлой версии
+	Breaking bool `json:"breaking"`
+	// Backfill - миграции понадобится заполнить или преобразовать данные
+	Backfill bool `json:"backfill,omitempty"`
+	// File, Line, Column - позиция в новой версии proto, если элемент остался
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+func (c BreakingChange) String() string {
+	where := c.Subject
+	if c.File != "" {
+		where = fmt.Sprintf("%s:%d:%d", c.File, c.Line, c.Column)
+	}
+	var tag string
+	switch {
+	case c.Breaking && c.Backfill:
+		tag = "breaking, needs backfill"
+	case c.Breaking:
+		tag = "breaking"
+	default:
+		tag = "needs backfill"
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", where, tag, c.Message, c.Rule)
+}
+
+// CompareSchemas сравнивает прошлый снимок old с новым next и возвращает
+// несовместимые изменения proto и разрушающие изменения схемы базы,
+// а также миграции, которым нужно заполнение данных
+func CompareSchemas(old, next *Schema) []BreakingChange {
+	var changes []BreakingChange
+	changes = append(changes, compareMessages(old, next)...)
+	changes = append(changes, compareEnums(old, next)...)
+	changes = append(changes, compareServices(old, next)...)
+	changes = append(changes, compareTables(old, next)...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Subject < changes[j].Subject
+	})
+	return changes
+}
+
+func compareMessages(old, next *Schema) []BreakingChange {
+	var changes []BreakingChange
+	messages := make(map[string]SchemaMessage, len(next.Messages))
+	for _, m := range next.Messages {
+		messages[m.Name] = m
+	}
+
+	for _, oldMsg := range old.Messages {
+		newMsg, ok := messages[oldMsg.Name]
+		if !ok {
+			changes = append(changes, BreakingChange{
+				Rule: "message-removed", Kind: "proto", Subject: oldMsg.Name, Breaking: true,
+				Message: fmt.Sprintf("message %s was removed", oldMsg.Name),
+			})
+			continue
+		}
+
+		byNumber := make(map[int]SchemaField, len(newMsg.Fields))
+		for _, f := range newMsg.Fields {
+			byNumber[f.Number] = f
+		}
+		for _, oldField := range oldMsg.Fields {
+			subject := oldMsg.Name + "." + oldField.Name
+			change := BreakingChange{Kind: "proto", Subject: subject, Breaking: true, File: newMsg.file}
+			newField, ok := byNumber[oldField.Number]
+			if !ok {
+				change.Rule = "field-removed"
+				change.File = ""
+				change.Message = fmt.Sprintf("field %s = %d was removed; reserve the number and name instead", subject, oldField.Number)
+				changes = append(changes, change)
+				continue
+			}
+			change.Line, change.Column = newField.line, newField.column
+
+			switch {
+			case newField.Type != oldField.Type:
+				change.Rule = "field-type-changed"
+				change.Message = fmt.Sprintf("field %s = %d changed type from %s to %s", subject, oldField.Number, oldField.Type, newField.Type)
+			case newField.Repeated != oldField.Repeated || newField.Map != oldField.Map:
+				change.Rule = "field-cardinality-changed"
+				change.Message = fmt.Sprintf("field %s = %d changed from %s to %s", subject, oldField.Number, cardinality(oldField), cardinality(newField))
+			case newField.Name != oldField.Name:
+				// Двоичный формат не меняется, но ломаются JSON и сгенерированный код
+				change.Rule = "field-renamed"
+				change.Message = fmt.Sprintf("field %s = %d was renamed to %s, which breaks JSON clients", subject, oldField.Number, newField.Name)
+			case newField.Oneof != oldField.Oneof:
+				change.Rule = "field-oneof-changed"
+				change.Message = fmt.Sprintf("field %s = %d moved from oneof %q to %q", subject, oldField.Number, oldField.Oneof, newField.Oneof)
+			default:
+				continue
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func cardinality(f SchemaField) string {
+	switch {
+	case f.Map:
+		return "map"
+	case f.Repeated:
+		return "repeated"
+	default:
+		return "singular"
+	}
+}
+
+func compareEnums(old, next *Schema) []BreakingChange {
+	var changes []BreakingChange
+	enums := make(map[string]SchemaEnum, len(next.Enums))
+	for _, e := range next.Enums {
+		enums[e.Name] = e
+	}
+
+	for _, oldEnum := range old.Enums {
+		newEnum, ok := enums[oldEnum.Name]
+		if !ok {
+			changes = append(changes, BreakingChange{
+				Rule: "enum-removed", Kind: "proto", Subject: oldEnum.Name, Breaking: true,
+				Message: fmt.Sprintf("enum %s was removed", oldEnum.Name),
+			})
+			continue
+		}
+
+		byNumber := make(map[int]string, len(newEnum.Values))
+		for _, v := range newEnum.Values {
+			byNumber[v.Number] = v.Name
+		}
+		for _, v := range oldEnum.Values {
+			name, ok := byNumber[v.Number]
+			switch {
+			case !ok:
+				changes = append(changes, BreakingChange{
+					Rule: "enum-value-removed", Kind: "proto", Subject: oldEnum.Name + "." + v.Name, Breaking: true,
+					Message: fmt.Sprintf("enum value %s = %d was removed", v.Name, v.Number),
+				})
+			case name != v.Name:
+				changes = append(changes, BreakingChange{
+					Rule: "enum-value-renamed", Kind: "proto", Subject: oldEnum.Name + "." + v.Name, Breaking: true,
+					Message: fmt.Sprintf("enum value %s = %d was renamed to %s, which breaks JSON clients", v.Name, v.Number, name),
+				})
+			}
+		}
+	}
+	return changes
+}
+
+func compareServices(old, next *Schema) []BreakingChange {
+	var changes []BreakingChange
+	services := make(map[string]SchemaService, len(next.Services))
+	for _, s := range next.Services {
+		services[s.Name] = s
+	}
+
+	for _, oldService := range old.Services {
+		newService, ok := services[oldService.Name]
+		if !ok {
+			changes = append(changes, BreakingChange{
+				Rule: "service-removed", Kind: "proto", Subject: oldService.Name, Breaking: true,
+				Message: fmt.Sprintf("service %s was removed", oldService.Name),
+			})
+			continue
+		}
+
+		methods := make(map[string]SchemaMethod, len(newService.Methods))
+		for _, m := range newService.Methods {
+			methods[m.Name] = m
+		}
+		for _, oldMethod := range oldService.Methods {
+			subject := oldService.Name + "." + oldMethod.Name
+			newMethod, ok := methods[oldMethod.Name]
+			if !ok {
+				changes = append(changes, BreakingChange{
+					Rule: "method-removed", Kind: "proto", Subject: subject, Breaking: true,
+					Message: fmt.Sprintf("method %s was removed", subject),
+				})
+				continue
+			}
+			if oldMethod.Input == "" || newMethod.Input == "" {
+				// Типы стандартных методов выводит protogen, сравнивать нечего
+				continue
+			}
+			if oldMethod != newMethod {
+				changes = append(changes, BreakingChange{
+					Rule: "method-signature-changed", Kind: "proto", Subject: subject, Breaking: true,
+					Message: fmt.Sprintf("method %s changed from %s to %s", subject, signature(oldMethod), signature(newMethod)),
+				})
+			}
+		}
+	}
+	return changes
+}
+
+func signature(m SchemaMethod) string {
+	input, output := m.Input, m.Output
+	if m.ClientStreaming {
+		input = "stream " + input
+	}
+	if m.ServerStreaming {
+		output = "stream " + output
+	}
+	return fmt.Sprintf("(%s) returns (%s)", input, output)
+}
+
+// compareTables сопоставляет таблицы по моделям, как миграции ALTER:
+// таблица, переименованная через настройки, переименовывается, а не
+// удаляется. Снимки без модели сопоставляются по имени таблицы.
+func compareTables(old, next *Schema) []BreakingChange {
+	var changes []BreakingChange
+	byModel := make(map[string]SchemaTable, len(next.Tables))
+	byName := make(map[string]SchemaTable, len(next.Tables))
+	for _, t := range next.Tables {
+		if t.Model != "" {
+			byModel[t.Model] = t
+		}
+		byName[t.Name] = t
+	}
+
+	for _, oldTable := range old.Tables {
+		newTable, ok := byModel[oldTable.Model]
+		if !ok || oldTable.Model == "" {
+			newTable, ok = byName[oldTable.Name]
+		}
+		if !ok {
+			changes = append(changes, BreakingChange{
+				Rule: "table-dropped", Kind: "schema", Subject: oldTable.Name, Breaking: true,
+				Message: fmt.Sprintf("table %s of %s would be dropped with all its data", oldTable.Name, oldTable.Model),
+			})
+			continue
+		}
+		if newTable.Name != oldTable.Name {
+			changes = append(changes, BreakingChange{
+				Rule: "table-renamed", Kind: "schema", Subject: oldTable.Name, Breaking: true,
+				Message: fmt.Sprintf("table %s of %s is renamed to %s; queries outside the service have to use the new name", oldTable.Name, oldTable.Model, newTable.Name),
+			})
+		}
+
+		columns := make(map[string]SchemaColumn, len(newTable.Columns))
+		for _, c := range newTable.Columns {
+			columns[c.Name] = c
+		}
+		oldColumns := make(map[string]bool, len(oldTable.Columns))
+		oldKey, newKey := keyColumns(oldTable), keyColumns(newTable)
+
+		for _, oldColumn := range oldTable.Columns {
+			oldColumns[oldColumn.Name] = true
+			subject := newTable.Name + "." + oldColumn.Name
+			newColumn, ok := columns[oldColumn.Name]
+			switch {
+			case !ok:
+				changes = append(changes, BreakingChange{
+					Rule: "column-dropped", Kind: "schema", Subject: subject, Breaking: true,
+					Message: fmt.Sprintf("column %s would be dropped with its data", subject),
+				})
+			// SERIAL типы - те же целые с последовательностью
+			case columnType(newColumn.Type) != columnType(oldColumn.Type):
+				changes = append(changes, BreakingChange{
+					Rule: "column-type-changed", Kind: "schema", Subject: subject, Breaking: true, Backfill: true,
+					Message: fmt.Sprintf("column %s changes type from %s to %s; existing values have to be converted", subject, oldColumn.Type, newColumn.Type),
+				})
+			case newColumn.NotNull && !oldColumn.NotNull && !newColumn.Default:
+				changes = append(changes, BreakingChange{
+					Rule: "column-not-null-added", Kind: "schema", Subject: subject, Breaking: true, Backfill: true,
+					Message: fmt.Sprintf("column %s becomes NOT NULL; existing NULLs have to be filled in first", subject),
+				})
+			}
+		}
+
+		for _, newColumn := range newTable.Columns {
+			if oldColumns[newColumn.Name] || !newColumn.NotNull || newColumn.Default {
+				continue
+			}
+			changes = append(changes, BreakingChange{
+				Rule: "column-added-not-null", Kind: "schema", Subject: newTable.Name + "." + newColumn.Name, Backfill: true,
+				Message: fmt.Sprintf("new NOT NULL column %s.%s has no default; existing rows need a value", newTable.Name, newColumn.Name),
+			})
+		}
+
+		if oldKey != newKey {
+			changes = append(changes, BreakingChange{
+				Rule: "primary-key-changed", Kind: "schema", Subject: newTable.Name, Breaking: true, Backfill: true,
+				Message: fmt.Sprintf("primary key of %s changes from (%s) to (%s)", newTable.Name, oldKey, newKey),
+			})
+		}
+	}
+	return changes
+}
+
+func keyColumns(t SchemaTable) string {
+	var key string
+	for _, c := range t.Columns {
+		if c.PrimaryKey {
+			if key != "" {
+				key += ", "
+			}
+			key += c.Name
+		}
+	}
+	return key
+}
@@ -0,0 +1,197 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareSchemas(t *testing.T) {
+	courier := func(fields ...SchemaField) *Schema {
+		return &Schema{Messages: []SchemaMessage{{Name: "shop.v1.Courier", Fields: fields}}}
+	}
+	status := func(values ...SchemaEnumValue) *Schema {
+		return &Schema{Enums: []SchemaEnum{{Name: "shop.v1.Status", Values: values}}}
+	}
+	service := func(methods ...SchemaMethod) *Schema {
+		return &Schema{Services: []SchemaService{{Name: "shop.v1.CourierService", Methods: methods}}}
+	}
+	couriers := func(columns ...SchemaColumn) *Schema {
+		return &Schema{Tables: []SchemaTable{{Name: "couriers", Model: "Courier", Columns: columns}}}
+	}
+	id := SchemaColumn{Name: "id", Type: "BIGSERIAL", NotNull: true, PrimaryKey: true, Default: true}
+
+	tests := []struct {
+		name string
+		old  *Schema
+		next *Schema
+		// want - пары правило и элемент в порядке вывода: по виду, затем по элементу
+		want [][2]string
+	}{
+		{
+			name: "no changes",
+			old:  courier(SchemaField{Name: "name", Number: 1, Type: "string"}),
+			next: courier(SchemaField{Name: "name", Number: 1, Type: "string"}),
+		},
+		{
+			name: "message removed",
+			old:  courier(),
+			next: &Schema{},
+			want: [][2]string{{"message-removed", "shop.v1.Courier"}},
+		},
+		{
+			name: "field added",
+			old:  courier(SchemaField{Name: "name", Number: 1, Type: "string"}),
+			next: courier(SchemaField{Name: "name", Number: 1, Type: "string"}, SchemaField{Name: "phone", Number: 2, Type: "string"}),
+		},
+		{
+			name: "field removed",
+			old:  courier(SchemaField{Name: "name", Number: 1, Type: "string"}),
+			next: courier(),
+			want: [][2]string{{"field-removed", "shop.v1.Courier.name"}},
+		},
+		{
+			name: "field type changed",
+			old:  courier(SchemaField{Name: "age", Number: 1, Type: "int32"}),
+			next: courier(SchemaField{Name: "age", Number: 1, Type: "int64"}),
+			want: [][2]string{{"field-type-changed", "shop.v1.Courier.age"}},
+		},
+		{
+			name: "field became repeated",
+			old:  courier(SchemaField{Name: "tag", Number: 1, Type: "string"}),
+			next: courier(SchemaField{Name: "tag", Number: 1, Type: "string", Repeated: true}),
+			want: [][2]string{{"field-cardinality-changed", "shop.v1.Courier.tag"}},
+		},
+		{
+			name: "field renamed",
+			old:  courier(SchemaField{Name: "phone", Number: 1, Type: "string"}),
+			next: courier(SchemaField{Name: "mobile", Number: 1, Type: "string"}),
+			want: [][2]string{{"field-renamed", "shop.v1.Courier.phone"}},
+		},
+		{
+			name: "field moved into oneof",
+			old:  courier(SchemaField{Name: "phone", Number: 1, Type: "string"}),
+			next: courier(SchemaField{Name: "phone", Number: 1, Type: "string", Oneof: "contact"}),
+			want: [][2]string{{"field-oneof-changed", "shop.v1.Courier.phone"}},
+		},
+		{
+			name: "enum values removed and renamed",
+			old:  status(SchemaEnumValue{Name: "ACTIVE", Number: 1}, SchemaEnumValue{Name: "IDLE", Number: 2}),
+			next: status(SchemaEnumValue{Name: "ENABLED", Number: 1}),
+			want: [][2]string{
+				{"enum-value-renamed", "shop.v1.Status.ACTIVE"},
+				{"enum-value-removed", "shop.v1.Status.IDLE"},
+			},
+		},
+		{
+			name: "enum removed",
+			old:  status(),
+			next: &Schema{},
+			want: [][2]string{{"enum-removed", "shop.v1.Status"}},
+		},
+		{
+			name: "standard method removed",
+			old:  service(SchemaMethod{Name: "Create"}, SchemaMethod{Name: "Delete"}),
+			next: service(SchemaMethod{Name: "Create"}),
+			want: [][2]string{{"method-removed", "shop.v1.CourierService.Delete"}},
+		},
+		{
+			name: "declared method became streaming",
+			old:  service(SchemaMethod{Name: "Track", Input: "shop.v1.TrackRequest", Output: "shop.v1.Location"}),
+			next: service(SchemaMethod{Name: "Track", Input: "shop.v1.TrackRequest", Output: "shop.v1.Location", ServerStreaming: true}),
+			want: [][2]string{{"method-signature-changed", "shop.v1.CourierService.Track"}},
+		},
+		{
+			name: "service removed",
+			old:  service(),
+			next: &Schema{},
+			want: [][2]string{{"service-removed", "shop.v1.CourierService"}},
+		},
+		{
+			name: "table dropped",
+			old:  couriers(id),
+			next: &Schema{},
+			want: [][2]string{{"table-dropped", "couriers"}},
+		},
+		{
+			name: "table renamed through the config",
+			old:  couriers(id, SchemaColumn{Name: "name", Type: "TEXT"}),
+			next: &Schema{Tables: []SchemaTable{{Name: "riders", Model: "Courier", Columns: []SchemaColumn{
+				id, {Name: "name", Type: "TEXT"},
+			}}}},
+			want: [][2]string{{"table-renamed", "couriers"}},
+		},
+		{
+			name: "table of a snapshot without models is matched by name",
+			old:  &Schema{Tables: []SchemaTable{{Name: "couriers", Columns: []SchemaColumn{id}}}},
+			next: couriers(id),
+		},
+		{
+			name: "serial column keeps its integer type",
+			old:  couriers(id, SchemaColumn{Name: "seq", Type: "SERIAL"}),
+			next: couriers(
+				SchemaColumn{Name: "id", Type: "BIGINT", NotNull: true, PrimaryKey: true},
+				SchemaColumn{Name: "seq", Type: "INTEGER"},
+			),
+		},
+		{
+			name: "column changes",
+			old: couriers(id,
+				SchemaColumn{Name: "name", Type: "TEXT"},
+				SchemaColumn{Name: "phone", Type: "TEXT"},
+				SchemaColumn{Name: "rating", Type: "INTEGER"},
+			),
+			next: couriers(id,
+				SchemaColumn{Name: "name", Type: "TEXT", NotNull: true},
+				SchemaColumn{Name: "rating", Type: "BIGINT"},
+				SchemaColumn{Name: "email", Type: "TEXT", NotNull: true},
+				SchemaColumn{Name: "note", Type: "TEXT"},
+			),
+			want: [][2]string{
+				{"column-added-not-null", "couriers.email"},
+				{"column-not-null-added", "couriers.name"},
+				{"column-dropped", "couriers.phone"},
+				{"column-type-changed", "couriers.rating"},
+			},
+		},
+		{
+			name: "not null column with default",
+			old:  couriers(id),
+			next: couriers(id, SchemaColumn{Name: "status", Type: "TEXT", NotNull: true, Default: true}),
+		},
+		{
+			name: "primary key changed",
+			old: couriers(id,
+				SchemaColumn{Name: "code", Type: "TEXT", NotNull: true},
+			),
+			next: couriers(
+				SchemaColumn{Name: "id", Type: "BIGSERIAL", NotNull: true, Default: true},
+				SchemaColumn{Name: "code", Type: "TEXT", NotNull: true, PrimaryKey: true},
+			),
+			want: [][2]string{{"primary-key-changed", "couriers"}},
+		},
+		{
+			name: "proto changes come before schema changes",
+			old: &Schema{
+				Messages: []SchemaMessage{{Name: "shop.v1.Courier"}},
+				Tables:   []SchemaTable{{Name: "couriers", Model: "Courier"}},
+			},
+			next: &Schema{},
+			want: [][2]string{
+				{"message-removed", "shop.v1.Courier"},
+				{"table-dropped", "couriers"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][2]string
+			for _, c := range CompareSchemas(tt.old, tt.next) {
+				got = append(got, [2]string{c.Rule, c.Subject})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompareSchemas() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
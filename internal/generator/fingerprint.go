@@ -0,0 +1,46 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// fingerprint возвращает отпечаток всего, что шаблоны модели получают из
+// proto и настроек сообщения: полей, ключа, ссылок, методов и типов-значений.
+// При тех же шаблонах и настройках проекта равные отпечатки дают одинаковые
+// файлы модели.
+func (m *Model) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "model %s %s %s %+v\n", m.Name, m.Table, m.Resource, m.API)
+	fmt.Fprintf(h, "key %s %s\n", m.PK.Strategy, m.PK.Columns())
+	for _, rpc := range m.RPCs {
+		fmt.Fprintf(h, "rpc %s %s %s %v\n", rpc.Name, rpc.Input, rpc.Output, rpc.imports)
+	}
+	writeFields(h, m.Fields, make(map[*ValueType]bool))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeFields пишет атрибуты полей и, один раз на тип, поля их типов-значений
+func writeFields(w io.Writer, fields []*Field, seen map[*ValueType]bool) {
+	for _, f := range fields {
+		fmt.Fprintf(w, "field %s %s %s %s %s %v %t %t %t %t %t %t %q\n",
+			f.Name, f.Type, f.JsonName, f.DbName, f.SqlType, f.Validations,
+			f.Repeated, f.Timestamp, f.Required, f.Key, f.DBGenerated, f.Deferred, f.SqlDefault)
+		if f.Ref != nil {
+			fmt.Fprintf(w, "ref %s %s %s %s\n", f.Ref.Name, f.Ref.Table, f.Ref.Resource, f.Ref.PK.Columns())
+		}
+		if f.Enum != "" {
+			fmt.Fprintf(w, "enum %s\n", f.Enum)
+		}
+		if f.Value == nil {
+			continue
+		}
+		fmt.Fprintf(w, "value %s %s\n", f.Value.Name, f.Value.ProtoName)
+		if !seen[f.Value] {
+			seen[f.Value] = true
+			writeFields(w, f.Value.Fields, seen)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package generator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/iancoleman/strcase"
+
+	"generator/internal/inflect"
+	"generator/internal/modpath"
+)
+
+// TemplateFuncs возвращает библиотеку функций, доступную во всех шаблонах,
+// включая пользовательские шаблоны из директории переопределения.
+//
+// Регистр и формы слов:
+//
+//	toLower, toUpper       - нижний и верхний регистр
+//	toCamel, toLowerCamel  - CamelCase и lowerCamelCase
+//	toSnake, toKebab       - snake_case и kebab-case
+//	toScreamingSnake       - SCREAMING_SNAKE_CASE
+//	pluralize, singularize - множественное и единственное число
+//	tableName              - имя таблицы по имени сообщения (delivery_zones)
+//	resourceName           - имя REST ресурса по имени сообщения (delivery-zones)
+//
+// Идентификаторы:
+//
+//	goIdent  - безопасный идентификатор Go ("type" -> "type_")
+//	sqlIdent - идентификатор SQL, в кавычках только если это необходимо
+//	sqlQuote - идентификатор SQL, всегда в двойных кавычках
+//
+// Строки и списки:
+//
+//	hasSuffix, hasPrefix, trimSuffix, trimPrefix, replace
+//	join   - соединяет элементы списка через разделитель
+//	indent - добавляет отступ ко всем непустым строкам текста
+//	idx    - номер по порядку для индекса range (i + 1)
+//
+// Модели и связи:
+//
+//	findModel  - модель по имени из списка моделей: findModel . "Location"
+//	findField  - поле модели по имени: findField . "location_id"
+//	isRef      - ссылается ли поле на другую модель
+//	refModel   - модель, на которую ссылается поле (или nil)
+//	relations  - поля модели, ссылающиеся на другие модели
+//	dependents - модели из списка, ссылающиеся на данную модель
+//	valueTypes - типы-значения (JSONB поля) всех моделей из списка
+//	usesKeyStrategy - есть ли в списке модель с данной стратегией ключа
+//
+// Проект:
+//
+//	module  - путь Go модуля генерируемого сервиса (app по умолчанию)
+//	project - версии, порты и включённые части проекта (Project)
+//
+// Сервисы:
+//
+//	services   - самостоятельные сервисы из proto файлов текущего запуска
+//	rpcImports - пакеты для типов пользовательских RPC моделей из списка
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"toLower":          strings.ToLower,
+		"toUpper":          strings.ToUpper,
+		"toCamel":          strcase.ToCamel,
+		"toLowerCamel":     strcase.ToLowerCamel,
+		"toSnake":          strcase.ToSnake,
+		"toKebab":          strcase.ToKebab,
+		"toScreamingSnake": strcase.ToScreamingSnake,
+		"pluralize":        inflect.Pluralize,
+		"singularize":      inflect.Singularize,
+		"tableName":        inflect.TableName,
+		"resourceName":     inflect.ResourceName,
+
+		"goIdent":  goIdent,
+		"sqlIdent": sqlIdent,
+		"sqlQuote": sqlQuote,
+
+		"hasSuffix":  strings.HasSuffix,
+		"hasPrefix":  strings.HasPrefix,
+		"trimSuffix": strings.TrimSuffix,
+		"trimPrefix": strings.TrimPrefix,
+		"replace":    strings.ReplaceAll,
+		"join":       join,
+		"indent":     indent,
+		"idx":        func(i int) int { return i + 1 },
+
+		"findModel":  findModel,
+		"findField":  findField,
+		"isRef":      func(f *Field) bool { return f.Ref != nil },
+		"refModel":   func(f *Field) *Model { return f.Ref },
+		"relations":  relations,
+		"dependents": dependents,
+		"valueTypes": valueTypes,
+
+		"usesKeyStrategy": usesKeyStrategy,
+
+		// module и project задаются генератором по настройкам
+		"module":  func() string { return modpath.Default },
+		"project": DefaultProject,
+
+		// services подменяется генератором перед каждым запуском
+		"services":   func() []*Service { return nil },
+		"rpcImports": modelRPCImports,
+	}
+}
+
+// goIdent превращает строку в допустимый идентификатор Go
+func goIdent(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+			b.WriteRune(r)
+		case unicode.IsDigit(r):
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	ident := b.String()
+	if ident == "" {
+		return "_"
+	}
+	if IsGoKeyword(ident) {
+		return ident + "_"
+	}
+	return ident
+}
+
+// sqlIdent заключает идентификатор в кавычки, только если без них
+// PostgreSQL его не примет или изменит регистр
+func sqlIdent(s string) string {
+	if IsSQLReserved(s) || !isPlainSQLIdent(s) {
+		return sqlQuote(s)
+	}
+	return s
+}
+
+// sqlQuote всегда заключает идентификатор в двойные кавычки
+func sqlQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func isPlainSQLIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z'):
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// join соединяет элементы любого списка через разделитель
+func join(sep string, items interface{}) (string, error) {
+	if s, ok := items.([]string); ok {
+		return strings.Join(s, sep), nil
+	}
+
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", items)
+	}
+
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// indent добавляет n пробелов перед каждой непустой строкой
+func indent(n int, text string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func findModel(models []*Model, name string) *Model {
+	for _, m := range models {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func findField(model *Model, name string) *Field {
+	for _, f := range model.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func relations(model *Model) []*Field {
+	var fields []*Field
+	for _, f := range model.Fields {
+		if f.Ref != nil {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func dependents(models []*Model, model *Model) []*Model {
+	var result []*Model
+	for _, m := range models {
+		for _, f := range m.Fields {
+			if f.Ref == model {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func modelRPCImports(models []*Model) []string {
+	var rpcs []*RPC
+	for _, m := range models {
+		rpcs = append(rpcs, m.RPCs...)
+	}
+	return rpcImports(rpcs)
+}
+
+func valueTypes(models []*Model) []*ValueType {
+	var types []*ValueType
+	for _, m := range models {
+		types = collectValueTypes(m.Fields, types)
+	}
+	return types
+}
+
+func usesKeyStrategy(models []*Model, strategy string) bool {
+	for _, m := range models {
+		if m.PK.Strategy == strategy {
+			return true
+		}
+	}
+	return false
+}
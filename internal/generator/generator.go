@@ -1,23 +1,122 @@
 package generator
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"log/slog"
 	"strings"
-	"time"
+
+	"generator/internal/modpath"
+	"generator/internal/outfs"
+	"generator/internal/protoload"
 )
 
 type Generator struct {
 	parser   *Parser
 	template *TemplateGenerator
+
+	// previous - манифест прошлого запуска, manifest - текущего
+	previous *Manifest
+	manifest *Manifest
+	// upgrade заполняется только во время команды upgrade
+	upgrade *UpgradeReport
+	// services - самостоятельные сервисы текущего запуска
+	services []*Service
+	project  Project
+	module   string
+	plugins  []Plugin
+	// changes - файлы, созданные, изменённые или удалённые текущим запуском
+	changes []Change
+
+	// incremental - перегенерировать только модели с изменившимся отпечатком
+	incremental bool
+	// fingerprints - отпечатки моделей прошлого запуска
+	fingerprints map[string]string
+	// regenerated - модели, файлы которых сгенерированы текущим запуском
+	regenerated []string
+	// applied - таблицы в том виде, в каком их создают выпущенные миграции
+	applied *appliedSchema
+	// migrationTime - метка времени в версиях миграций текущего запуска
+	migrationTime string
+	// protoPackage - пакет выходных proto файлов, в который protogen
+	// кладёт сервисы
+	protoPackage string
+
+	logger *slog.Logger
 }
 
-func New() *Generator {
-	return &Generator{
-		parser:   NewParser(),
-		template: NewTemplateGenerator(),
+// Options - настройки генератора
+type Options struct {
+	// TemplatesDir - директория с шаблонами, переопределяющими встроенные
+	TemplatesDir string
+	// LegacyEntities - таблицей становится каждое сообщение, кроме *Request
+	// и *Response, вместо сообщений с (appgen.entity)
+	LegacyEntities bool
+	// Module - путь Go модуля генерируемого сервиса, по умолчанию modpath.Default
+	Module string
+	// ProtoPackage - пакет выходных proto файлов, по умолчанию выводится
+	// из Module так же, как в protogen
+	ProtoPackage string
+	// ImportPaths - директории, относительно которых разрешаются импорты proto файлов
+	ImportPaths []string
+	// Overrides - параметры сообщений из конфигурации проекта
+	Overrides map[string]protoload.Override
+	// Project - версии, порты и части проекта, по умолчанию DefaultProject
+	Project *Project
+	// Incremental - повторные запуски того же генератора перегенерируют
+	// файлы и миграции только тех моделей, описание которых изменилось.
+	// Общие файлы и самостоятельные сервисы генерируются всегда.
+	Incremental bool
+	// Logger - журнал разбора и генерации, по умолчанию slog.Default()
+	Logger *slog.Logger
+	// Plugins - плагины, которые добавляют в проект свои файлы
+	Plugins []Plugin
+}
+
+func New(opts Options) (*Generator, error) {
+	if opts.Module == "" {
+		opts.Module = modpath.Default
+	}
+	if err := modpath.Check(opts.Module); err != nil {
+		return nil, err
+	}
+	if opts.ProtoPackage == "" {
+		opts.ProtoPackage = modpath.ProtoPackage(opts.Module)
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	tmpl, err := NewTemplateGenerator(opts.TemplatesDir, opts.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+	project := DefaultProject()
+	if opts.Project != nil {
+		project = *opts.Project
 	}
+	tmpl.setModule(opts.Module)
+	tmpl.setProject(project)
+
+	parser := NewParser()
+	parser.legacyEntities = opts.LegacyEntities
+	parser.protoImport = modpath.ProtoImport(opts.Module)
+	parser.importPaths = opts.ImportPaths
+	parser.overrides = opts.Overrides
+	parser.logger = opts.Logger
+
+	return &Generator{
+		parser:       parser,
+		template:     tmpl,
+		project:      project,
+		module:       opts.Module,
+		protoPackage: opts.ProtoPackage,
+		plugins:      opts.Plugins,
+		incremental:  opts.Incremental,
+		logger:       opts.Logger,
+	}, nil
 }
 
 // GenerateFromProto генерирует код из одного proto файла
@@ -27,228 +126,446 @@ func (g *Generator) GenerateFromProto(protoPath, outputDir string) error {
 
 // GenerateFromProtoFiles генерирует код из нескольких proto файлов
 func (g *Generator) GenerateFromProtoFiles(protoFiles []string, outputDir string) error {
+	return g.Generate(context.Background(), protoFiles, outfs.NewOS(outputDir))
+}
+
+// Generate генерирует код из proto файлов в файловую систему dst. Манифест
+// и базовые версии файлов читаются и пишутся там же, в .appgen. Контекст
+// передаётся плагинам.
+func (g *Generator) Generate(ctx context.Context, protoFiles []string, dst outfs.FS) error {
+	allModels, err := g.parseFiles(protoFiles)
+	if err != nil {
+		return err
+	}
+	return g.generateModels(ctx, allModels, dst)
+}
+
+// Models разбирает proto файлы и возвращает модели в порядке создания
+// таблиц: со связанными ссылками и отложенными внешними ключами циклов.
+// Файлы не генерируются.
+func (g *Generator) Models(protoFiles []string) ([]*Model, error) {
+	allModels, err := g.parseFiles(protoFiles)
+	if err != nil {
+		return nil, err
+	}
+	if err := linkModels(allModels); err != nil {
+		return nil, err
+	}
+	return orderModels(allModels)
+}
+
+// Prime запоминает отпечатки моделей proto файлов, ничего не генерируя.
+// Следующий инкрементальный запуск перегенерирует только модели, описание
+// которых с тех пор изменилось, поэтому выходная директория должна быть
+// сгенерирована по этим же proto файлам.
+func (g *Generator) Prime(protoFiles []string) error {
+	models, err := g.Models(protoFiles)
+	if err != nil {
+		return err
+	}
+	g.fingerprints = make(map[string]string, len(models))
+	for _, model := range models {
+		g.fingerprints[model.Name] = model.fingerprint()
+	}
+	return nil
+}
+
+// parseFiles разбирает proto файлы и запоминает самостоятельные сервисы
+func (g *Generator) parseFiles(protoFiles []string) ([]*Model, error) {
 	var allModels []*Model
+	var allServices []*Service
 
+	g.parser.files = nil
 	for _, protoPath := range protoFiles {
-		models, err := g.parser.Parse(protoPath)
+		models, services, err := g.parser.Parse(protoPath)
 		if err != nil {
-			return fmt.Errorf("failed to parse %s: %w", protoPath, err)
+			return nil, fmt.Errorf("failed to parse %s: %w", protoPath, err)
 		}
-		fmt.Printf("Parsed models from %s: %+v\n", protoPath, models)
+		g.logger.Debug("parsed proto file", "path", protoPath, "models", modelNames(models), "services", len(services))
 		allModels = append(allModels, models...)
+		allServices = append(allServices, services...)
+	}
+
+	standalone, err := attachServices(allModels, allServices)
+	if err != nil {
+		return nil, err
+	}
+	g.services = standalone
+	g.template.setServices(standalone)
+	return allModels, nil
+}
+
+// generateModels генерирует все файлы проекта по уже разобранным моделям
+func (g *Generator) generateModels(ctx context.Context, allModels []*Model, dst outfs.FS) error {
+	if err := linkModels(allModels); err != nil {
+		return err
 	}
 
+	previous, err := LoadManifest(dst)
+	if err != nil {
+		return err
+	}
+	g.previous = previous
+	g.manifest = &Manifest{Version: manifestVersion}
+	g.changes = nil
+	g.regenerated = nil
+
 	// Сортируем модели по зависимостям
-	sortedModels := g.sortModelsByDependencies(allModels)
+	sortedModels, err := g.sortModelsByDependencies(allModels)
+	if err != nil {
+		return err
+	}
+
+	fingerprints := make(map[string]string, len(sortedModels))
+	changed := make(map[string]bool, len(sortedModels))
+	for _, model := range sortedModels {
+		fingerprints[model.Name] = model.fingerprint()
+		if g.unchanged(model.Name, fingerprints[model.Name], dst) {
+			g.carryManifest(model.Name)
+			continue
+		}
+		changed[model.Name] = true
+		g.regenerated = append(g.regenerated, model.Name)
+	}
 
-	if err := g.generateCommonFiles(allModels, outputDir); err != nil {
+	if err := g.generateCommonFiles(allModels, dst); err != nil {
 		return fmt.Errorf("failed to generate common files: %w", err)
 	}
 
 	// Сначала генерируем все файлы кроме миграций
 	for i, model := range sortedModels {
-		if err := g.generateFilesForModel(model, outputDir, i); err != nil {
+		if !changed[model.Name] {
+			continue
+		}
+		if err := g.generateFilesForModel(model, dst, i); err != nil {
 			return fmt.Errorf("failed to generate files for model %s: %w", model.Name, err)
 		}
 	}
 
-	// Затем генерируем миграции в том же порядке что и модели
+	for _, service := range g.services {
+		if err := g.generateFilesForService(service, dst); err != nil {
+			return fmt.Errorf("failed to generate files for service %s: %w", service.ProtoName, err)
+		}
+	}
+
+	// Затем генерируем миграции в том же порядке что и модели. Выпущенные
+	// миграции не переписываются: изменения модели попадают в новую
+	// миграцию ALTER после всех миграций создания.
+	applied, err := loadAppliedSchema(dst)
+	if err != nil {
+		return err
+	}
+	g.applied = applied
+	if g.migrationTime, err = migrationStamp(dst); err != nil {
+		return err
+	}
+	if len(sortedModels) > 0 {
+		if err := g.generateFunctionsMigration(dst); err != nil {
+			return fmt.Errorf("failed to generate functions migration: %w", err)
+		}
+	}
+	created := make(map[string]bool, len(sortedModels))
 	for i, model := range sortedModels {
-		if err := g.generateMigration(model, outputDir, i); err != nil {
+		if !changed[model.Name] {
+			continue
+		}
+		ok, err := g.generateCreateMigration(model, dst, i)
+		if err != nil {
 			return fmt.Errorf("failed to generate migration for model %s: %w", model.Name, err)
 		}
-		// Добавляем задержку между генерацией миграций
-		time.Sleep(time.Second)
+		created[model.Name] = ok
 	}
 
+	// Внешние ключи, замыкающие циклы, добавляются после создания всех таблиц
+	for i, model := range sortedModels {
+		if !created[model.Name] || len(model.DeferredRefs()) == 0 {
+			continue
+		}
+		if err := g.writeMigration(model.Name, model, dst, len(sortedModels)+i, foreignKeysMigration); err != nil {
+			return fmt.Errorf("failed to generate foreign keys migration for model %s: %w", model.Name, err)
+		}
+	}
+
+	for i, model := range sortedModels {
+		if !changed[model.Name] || created[model.Name] {
+			continue
+		}
+		if err := g.generateAlterMigration(model, dst, 2*len(sortedModels)+i); err != nil {
+			return fmt.Errorf("failed to generate alter migration for model %s: %w", model.Name, err)
+		}
+	}
+	g.keepMigrations(dst)
+
+	if err := g.generatePlugins(ctx, sortedModels, dst); err != nil {
+		return err
+	}
+
+	if err := g.removeStaleFiles(dst); err != nil {
+		return err
+	}
+
+	if err := g.manifest.Save(dst); err != nil {
+		return err
+	}
+	if err := g.applied.save(dst); err != nil {
+		return err
+	}
+	if g.incremental {
+		g.fingerprints = fingerprints
+	}
 	return nil
 }
 
-func (g *Generator) generateCommonFiles(models []*Model, outputDir string) error {
-	commonFiles := map[string]string{
-		"main.go.tmpl":            filepath.Join(outputDir, "cmd", "app", "main.go"),
-		"go.mod.tmpl":             filepath.Join(outputDir, "go.mod"),
-		"docker-compose.yml.tmpl": filepath.Join(outputDir, "docker-compose.yml"),
-		"Dockerfile.tmpl":         filepath.Join(outputDir, "Dockerfile"),
-		"env.tmpl":                filepath.Join(outputDir, ".env"),
-		"repository.go.tmpl":      filepath.Join(outputDir, "internal", "repository", "repository.go"),
-		"interfaces.go.tmpl":      filepath.Join(outputDir, "internal", "interfaces", "interfaces.go"),
-		"gitlab-ci.yml.tmpl":      filepath.Join(outputDir, ".gitlab-ci.yml"),
-		"grpc_test.go.tmpl":       filepath.Join(outputDir, "internal", "tests", "grpc_test.go"),
+// unchanged сообщает, можно ли оставить файлы модели от прошлого запуска:
+// отпечаток не изменился и все её файлы на месте
+func (g *Generator) unchanged(name, fingerprint string, dst outfs.FS) bool {
+	if !g.incremental || g.fingerprints[name] != fingerprint {
+		return false
+	}
+	found := false
+	for _, entry := range g.previous.Files {
+		if entry.Model != name {
+			continue
+		}
+		found = true
+		if _, err := fs.Stat(dst, entry.Path); err != nil {
+			return false
+		}
 	}
+	return found
+}
 
-	for tmpl, outPath := range commonFiles {
-		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
-			return fmt.Errorf("failed to create directory for %s: %w", outPath, err)
+// carryManifest переносит записи о файлах модели из прошлого манифеста,
+// чтобы не перегенерированные файлы не считались устаревшими. Файлы
+// плагинов не переносятся: плагины запускаются всегда.
+func (g *Generator) carryManifest(name string) {
+	for _, entry := range g.previous.Files {
+		if entry.Model == name && !isPluginFile(entry) {
+			g.manifest.Files = append(g.manifest.Files, entry)
 		}
+	}
+}
 
-		data := map[string]interface{}{
-			"Models": models,
+func (g *Generator) generateCommonFiles(models []*Model, dst outfs.FS) error {
+	outputs := append(append([]output{}, commonOutputs...), g.template.commonOutputs...)
+	for _, out := range outputs {
+		if !g.project.enabled(out.feature) {
+			continue
+		}
+		content, err := g.template.render(out.template, models)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", out.path, err)
 		}
 
-		if err := g.template.generateFromTemplateWithVars(tmpl, outPath, data, models); err != nil {
-			return fmt.Errorf("failed to generate %s: %w", outPath, err)
+		if err := g.writeFile(dst, out, "", content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", out.path, err)
 		}
 	}
 
 	return nil
 }
 
-func (g *Generator) generateFilesForModel(model *Model, outputDir string, modelIndex int) error {
-	files := map[string]string{
-		"repository_model.go.tmpl": filepath.Join(outputDir, "internal", "repository", strings.ToLower(model.Name), "repository.go"),
-		"models.go.tmpl":           filepath.Join(outputDir, "internal", "models", strings.ToLower(model.Name)+".go"),
-		"grpc.go.tmpl":             filepath.Join(outputDir, "internal", "grpc", strings.ToLower(model.Name), "server.go"),
-	}
+func (g *Generator) generateFilesForModel(model *Model, dst outfs.FS, modelIndex int) error {
+	outputs := append(append([]output{}, modelOutputs...), g.template.modelOutputs...)
+	for _, out := range outputs {
+		content, err := g.template.render(out.template, model)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", out.pathFor(model.Name), err)
+		}
 
-	// Генерируем файл сервиса
-	servicePath := filepath.Join(outputDir, "internal", "service", strings.ToLower(model.Name))
-	if err := os.MkdirAll(servicePath, 0755); err != nil {
-		return fmt.Errorf("failed to create service directory: %w", err)
+		if err := g.writeFile(dst, out, model.Name, content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", out.pathFor(model.Name), err)
+		}
 	}
 
-	if err := g.template.generateFromTemplateWithVars("service.go.tmpl",
-		filepath.Join(servicePath, "service.go"), nil, model); err != nil {
-		return fmt.Errorf("failed to generate service file: %w", err)
-	}
+	return nil
+}
 
-	// Генерируем остальные файлы
-	for tmpl, outPath := range files {
-		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
-			return fmt.Errorf("failed to create directory for %s: %w", outPath, err)
+// generateFilesForService генерирует сервис и gRPC обработчики для
+// самостоятельного сервиса из proto файла
+func (g *Generator) generateFilesForService(service *Service, dst outfs.FS) error {
+	for _, out := range serviceOutputs {
+		content, err := g.template.render(out.template, service)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", out.pathFor(service.Name), err)
 		}
 
-		if err := g.template.generateFromTemplateWithVars(tmpl, outPath, nil, model); err != nil {
-			return fmt.Errorf("failed to generate %s: %w", outPath, err)
+		if err := g.writeFile(dst, out, service.Name, content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", out.pathFor(service.Name), err)
 		}
 	}
 
 	return nil
 }
 
-// buildDependencyGraph строит граф зависимостей между моделями
-func (g *Generator) buildDependencyGraph(models []*Model) map[string][]string {
-	dependencies := make(map[string][]string)
-	for _, model := range models {
-		deps := []string{}
-		for _, field := range model.Fields {
-			if strings.HasSuffix(field.Name, "_id") {
-				referencedModel := strings.TrimSuffix(field.Name, "_id")
-				deps = append(deps, referencedModel)
-			}
-		}
-		dependencies[model.Name] = deps
+func modelNames(models []*Model) []string {
+	names := make([]string, len(models))
+	for i, m := range models {
+		names[i] = m.Name
 	}
-	return dependencies
+	return names
 }
 
-// sortModelsByDependencies сортирует модели так, чтобы зависимые таблицы создавались после зависимостей
-func (g *Generator) sortModelsByDependencies(models []*Model) []*Model {
-	graph := g.buildDependencyGraph(models)
-	visited := make(map[string]bool)
-	visiting := make(map[string]bool) // Для обнаружения циклических зависимостей
-	sorted := make([]*Model, 0)
-
-	// Выводим дерево зависимостей
-	fmt.Println("\nDependency tree:")
-	g.printDependencyTree(graph, "", "", make(map[string]bool))
-	fmt.Println()
-
-	var visit func(model *Model)
-	visit = func(model *Model) {
-		if visited[model.Name] {
-			return
+// modelDependencies возвращает модели, таблицы которых должны существовать до
+// таблицы model, в порядке полей
+func modelDependencies(model *Model) []*Model {
+	var deps []*Model
+	for _, field := range model.Fields {
+		// Ссылка модели на саму себя не влияет на порядок создания таблиц
+		if field.Ref == nil || field.Ref == model || field.Deferred {
+			continue
 		}
-		if visiting[model.Name] {
-			panic(fmt.Sprintf("circular dependency detected: %s", model.Name))
+		if !containsModel(deps, field.Ref) {
+			deps = append(deps, field.Ref)
 		}
+	}
+	return deps
+}
 
-		visiting[model.Name] = true
-
-		for _, dep := range graph[model.Name] {
-			for _, m := range models {
-				if m.Name == dep {
-					visit(m)
-				}
-			}
+func containsModel(models []*Model, model *Model) bool {
+	for _, m := range models {
+		if m == model {
+			return true
 		}
-		visiting[model.Name] = false
-		visited[model.Name] = true
-		sorted = append([]*Model{model}, sorted...) // Добавляем в начало списка
 	}
+	return false
+}
 
-	for _, model := range models {
-		if !visited[model.Name] {
-			visit(model)
-		}
+// CycleError - цикл ссылок между моделями, который нельзя разорвать:
+// каждая ссылка цикла обязательна или входит в первичный ключ, поэтому
+// ни одну запись цикла нельзя создать первой
+type CycleError struct {
+	// Models - модели цикла по порядку, первая повторяется в конце
+	Models []string
+	// Fields - поля ссылок: Fields[i] ведёт из Models[i] в Models[i+1]
+	Fields []string
+}
+
+func (e *CycleError) Error() string {
+	var path strings.Builder
+	for i, field := range e.Fields {
+		fmt.Fprintf(&path, "%s.%s -> ", e.Models[i], field)
 	}
+	path.WriteString(e.Models[len(e.Models)-1])
+	return fmt.Sprintf("circular reference %s: every reference in the cycle is required or part of a key, make one of them optional", path.String())
+}
 
-	// Выводим порядок генерации
-	fmt.Println("Generation order:")
-	for i, model := range sorted {
-		fmt.Printf("%d. %s\n", i+1, model.Name)
+// sortModelsByDependencies сортирует модели так, чтобы зависимые таблицы
+// создавались после зависимостей, и пишет порядок в журнал
+func (g *Generator) sortModelsByDependencies(models []*Model) ([]*Model, error) {
+	sorted, err := orderModels(models)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println()
 
-	return sorted
+	for _, model := range sorted {
+		g.logger.Debug("model dependencies", "model", model.Name, "depends_on", modelNames(modelDependencies(model)))
+		for _, f := range model.DeferredRefs() {
+			g.logger.Info("foreign key is added after all tables to break a reference cycle",
+				"model", model.Name, "field", f.Name, "references", f.Ref.Name)
+		}
+	}
+	g.logger.Debug("generation order", "models", modelNames(sorted))
+
+	return sorted, nil
+}
+
+// orderModels возвращает модели в порядке создания таблиц. Цикл ссылок
+// разрывается необязательной ссылкой: её внешний ключ создаётся отдельной
+// миграцией после всех таблиц. Цикл из одних обязательных ссылок
+// возвращается как *CycleError.
+func orderModels(models []*Model) ([]*Model, error) {
+	for {
+		sorted, cycle := sortModels(models)
+		if cycle == nil {
+			return sorted, nil
+		}
+		fields, ok := breakCycle(cycle)
+		if !ok {
+			return nil, newCycleError(cycle)
+		}
+		for _, f := range fields {
+			f.Deferred = true
+		}
+	}
 }
 
-// printDependencyTree выводит дерево зависимостей в консоль
-func (g *Generator) printDependencyTree(graph map[string][]string, prefix string, name string, visited map[string]bool) {
-	if name == "" {
-		// Находим корневые узлы (без зависимостей)
-		hasIncoming := make(map[string]bool)
-		for _, deps := range graph {
-			for _, dep := range deps {
-				hasIncoming[dep] = true
+// sortModels упорядочивает модели обходом в глубину. Если зависимости
+// образуют цикл, возвращается его путь: модели по порядку, первая
+// повторяется в конце.
+func sortModels(models []*Model) (sorted, cycle []*Model) {
+	visited := make(map[*Model]bool)
+	var stack []*Model // Модели текущего пути, для обнаружения циклов
+
+	var visit func(model *Model) bool
+	visit = func(model *Model) bool {
+		for i, m := range stack {
+			if m == model {
+				cycle = append(append([]*Model{}, stack[i:]...), model)
+				return false
 			}
 		}
+		if visited[model] {
+			return true
+		}
 
-		for node := range graph {
-			if !hasIncoming[node] {
-				g.printDependencyTree(graph, "", node, visited)
+		stack = append(stack, model)
+		for _, dep := range modelDependencies(model) {
+			if !visit(dep) {
+				return false
 			}
 		}
-		return
+		stack = stack[:len(stack)-1]
+		visited[model] = true
+		sorted = append(sorted, model) // Зависимости уже добавлены раньше
+		return true
 	}
 
-	if visited[name] {
-		fmt.Printf("%s%s (circular)\n", prefix, name)
-		return
+	for _, model := range models {
+		if !visit(model) {
+			return nil, cycle
+		}
 	}
+	return sorted, nil
+}
 
-	visited[name] = true
-	fmt.Printf("%s%s\n", prefix, name)
-
-	for i, dep := range graph[name] {
-		nextPrefix := prefix + "│   "
-		if i == len(graph[name])-1 {
-			nextPrefix = prefix + "    "
+// breakCycle выбирает ссылку цикла, внешний ключ которой можно отложить:
+// все поля ссылки необязательны и не входят в ключ. Проверка идёт с
+// последней ссылки, замыкающей цикл при обходе.
+func breakCycle(cycle []*Model) ([]*Field, bool) {
+	for i := len(cycle) - 2; i >= 0; i-- {
+		fields := refFields(cycle[i], cycle[i+1])
+		optional := true
+		for _, f := range fields {
+			if f.Required || f.Key {
+				optional = false
+			}
+		}
+		if optional {
+			return fields, true
 		}
-		g.printDependencyTree(graph, nextPrefix, dep, visited)
 	}
-
-	visited[name] = false
+	return nil, false
 }
 
-func (g *Generator) generateMigration(model *Model, outputDir string, index int) error {
-	now := time.Now()
-	// Используем базовый timestamp и добавляем индекс для сортировки
-	baseVersion := now.Format("20060102150405")
-	// Добавляем индекс в начало версии для правильной сортировки зависимостей
-	version := fmt.Sprintf("%s%02d", baseVersion, index+1)
-	migrationPath := filepath.Join(outputDir, "migrations")
-
-	if err := os.MkdirAll(migrationPath, 0755); err != nil {
-		return fmt.Errorf("failed to create migrations directory: %w", err)
+// refFields возвращает неотложенные поля from, ссылающиеся на to
+func refFields(from, to *Model) []*Field {
+	var fields []*Field
+	for _, f := range from.Fields {
+		if f.Ref == to && !f.Deferred {
+			fields = append(fields, f)
+		}
 	}
+	return fields
+}
 
-	filename := fmt.Sprintf("%s_create_%s.sql", version, strings.ToLower(model.Name))
-	fullPath := filepath.Join(migrationPath, filename)
-
-	if err := g.template.generateFromTemplateWithVars("migration.sql.tmpl", fullPath, nil, model); err != nil {
-		return fmt.Errorf("failed to generate migration file: %w", err)
+func newCycleError(cycle []*Model) *CycleError {
+	err := &CycleError{}
+	for i, model := range cycle {
+		err.Models = append(err.Models, model.Name)
+		if i < len(cycle)-1 {
+			err.Fields = append(err.Fields, refFields(model, cycle[i+1])[0].Name)
+		}
 	}
-
-	return nil
+	return err
 }
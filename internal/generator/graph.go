@@ -0,0 +1,169 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Graph - схема базы данных сгенерированного сервиса: таблицы моделей и
+// ссылки между ними. Выгружается в DOT, Mermaid и JSON для документации.
+type Graph struct {
+	Models    []GraphModel    `json:"models"`
+	Relations []GraphRelation `json:"relations"`
+}
+
+// GraphModel - модель и колонки её таблицы
+type GraphModel struct {
+	Name    string        `json:"name"`
+	Table   string        `json:"table"`
+	Columns []GraphColumn `json:"columns"`
+}
+
+// GraphColumn - колонка таблицы модели
+type GraphColumn struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+	NotNull    bool   `json:"not_null,omitempty"`
+	// References - таблица, на которую ссылается колонка
+	References string `json:"references,omitempty"`
+}
+
+// GraphRelation - ссылка поля модели From на модель To
+type GraphRelation struct {
+	From  string `json:"from"`
+	Field string `json:"field"`
+	To    string `json:"to"`
+	// Required - у записи From всегда есть запись To
+	Required bool `json:"required"`
+	// Unique - поле является ключом From, на запись To ссылается не больше
+	// одной записи From
+	Unique bool `json:"unique,omitempty"`
+	// Deferred - внешний ключ создаётся отдельной миграцией, чтобы разорвать цикл
+	Deferred bool `json:"deferred,omitempty"`
+}
+
+// NewGraph строит схему по моделям в порядке создания таблиц, как их
+// возвращает Generator.Models
+func NewGraph(models []*Model) *Graph {
+	g := &Graph{Models: []GraphModel{}, Relations: []GraphRelation{}}
+	for _, m := range models {
+		gm := GraphModel{Name: m.Name, Table: m.Table}
+		for _, f := range m.Fields {
+			column := GraphColumn{
+				Name:       strings.ToLower(f.DbName),
+				Type:       f.SqlType,
+				PrimaryKey: f.Key,
+				NotNull:    f.Key || f.Required,
+			}
+			if f.Ref != nil {
+				column.References = f.Ref.Table
+				g.Relations = append(g.Relations, GraphRelation{
+					From:     m.Name,
+					Field:    f.Name,
+					To:       f.Ref.Name,
+					Required: f.Key || f.Required,
+					Unique:   f.Key && !m.PK.Composite(),
+					Deferred: f.Deferred,
+				})
+			}
+			gm.Columns = append(gm.Columns, column)
+		}
+		// Колонки времени добавляет шаблон миграции каждой таблице
+		gm.Columns = append(gm.Columns,
+			GraphColumn{Name: "created_at", Type: "TIMESTAMPTZ", NotNull: true},
+			GraphColumn{Name: "updated_at", Type: "TIMESTAMPTZ", NotNull: true},
+		)
+		g.Models = append(g.Models, gm)
+	}
+	return g
+}
+
+// WriteJSON записывает схему в JSON
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT записывает граф моделей для Graphviz: узел - модель и её
+// таблица, ребро - ссылка от зависимой модели. Отложенные ссылки пунктиром.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph models {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, m := range g.Models {
+		fmt.Fprintf(&b, "  %q [label=%q];\n", m.Name, m.Name+"\n"+m.Table)
+	}
+	for _, r := range g.Relations {
+		attrs := []string{fmt.Sprintf("label=%q", r.Field)}
+		if r.Deferred {
+			attrs = append(attrs, "style=dashed")
+		}
+		if !r.Required {
+			attrs = append(attrs, "arrowhead=empty")
+		}
+		fmt.Fprintf(&b, "  %q -> %q [%s];\n", r.From, r.To, strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid записывает ER диаграмму Mermaid: таблицы с колонками и
+// типами, связи с кратностью по внешним ключам
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	tables := make(map[string]string, len(g.Models))
+	for _, m := range g.Models {
+		tables[m.Name] = m.Table
+	}
+
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+	for _, m := range g.Models {
+		fmt.Fprintf(&b, "    %s {\n", m.Table)
+		for _, c := range m.Columns {
+			var keys []string
+			if c.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if c.References != "" {
+				keys = append(keys, "FK")
+			}
+			line := mermaidType(c.Type) + " " + c.Name
+			if len(keys) > 0 {
+				line += " " + strings.Join(keys, ", ")
+			}
+			if c.NotNull && !c.PrimaryKey {
+				line += ` "NOT NULL"`
+			}
+			fmt.Fprintf(&b, "        %s\n", line)
+		}
+		b.WriteString("    }\n")
+	}
+	for _, r := range g.Relations {
+		// Слева - сколько записей To у записи From, справа - сколько записей
+		// From ссылаются на запись To
+		left := "|o"
+		if r.Required {
+			left = "||"
+		}
+		right := "o{"
+		if r.Unique {
+			right = "o|"
+		}
+		fmt.Fprintf(&b, "    %s %s--%s %s : %q\n", tables[r.To], left, right, tables[r.From], r.Field)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidType приводит SQL тип к виду, допустимому в Mermaid: без пробелов
+func mermaidType(sqlType string) string {
+	return strings.ReplaceAll(sqlType, " ", "_")
+}
@@ -0,0 +1,36 @@
+package generator
+
+import (
+	"go/token"
+	"strings"
+)
+
+// sqlReserved - зарезервированные слова PostgreSQL, которые нельзя использовать
+// как имена таблиц и колонок без кавычек
+var sqlReserved = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		all analyse analyze and any array as asc asymmetric authorization binary both
+		case cast check collate collation column concurrently constraint create cross
+		current_catalog current_date current_role current_schema current_time
+		current_timestamp current_user default deferrable desc distinct do else end
+		except false fetch for foreign freeze from full grant group having ilike in
+		initially inner intersect into is isnull join lateral leading left like limit
+		localtime localtimestamp natural not notnull null offset on only or order outer
+		overlaps placing primary references returning right select session_user similar
+		some symmetric table tablesample then to trailing true union unique user using
+		variadic verbose when where window with`) {
+		sqlReserved[word] = true
+	}
+}
+
+// IsSQLReserved сообщает, является ли слово зарезервированным в PostgreSQL
+func IsSQLReserved(word string) bool {
+	return sqlReserved[strings.ToLower(word)]
+}
+
+// IsGoKeyword сообщает, является ли слово ключевым словом Go
+func IsGoKeyword(word string) bool {
+	return token.IsKeyword(word)
+}
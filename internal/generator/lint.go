@@ -0,0 +1,259 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"generator/internal/protoload"
+)
+
+// Severity - важность замечания линтера
+type Severity string
+
+const (
+	// SeverityError - сгенерированный сервис не соберётся или сломается
+	SeverityError Severity = "error"
+	// SeverityWarning - код соберётся, но это скорее всего ошибка
+	SeverityWarning Severity = "warning"
+)
+
+// LintRule - правило appgen lint
+type LintRule struct {
+	ID          string
+	Severity    Severity
+	Description string
+}
+
+// LintRules - все правила appgen lint
+var LintRules = []LintRule{
+	{ID: "missing-key", Severity: SeverityError, Description: "entity has no id field and no (appgen.primary_key)"},
+	{ID: "key-type", Severity: SeverityError, Description: "key field is not a singular int64 or string"},
+	{ID: "invalid-key", Severity: SeverityError, Description: "(appgen.primary_key) cannot be used as written"},
+	{ID: "unknown-ref", Severity: SeverityWarning, Description: "reference to an entity that does not exist; an error for (appgen.field).ref"},
+	{ID: "ref-type", Severity: SeverityError, Description: "reference field type differs from the key it refers to"},
+	{ID: "sql-reserved", Severity: SeverityError, Description: "table or column name is a reserved SQL keyword; generated SQL does not quote identifiers"},
+	{ID: "reserved-column", Severity: SeverityError, Description: "column clashes with created_at or updated_at that every table gets"},
+	{ID: "repeated-scalar", Severity: SeverityError, Description: "repeated scalar or enum field of an entity; only repeated messages are stored, as JSONB"},
+}
+
+// LintIssue - замечание линтера к сообщению или полю proto файла
+type LintIssue struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file"`
+	// Line, Column - позиция объявления, с единицы; 0, если неизвестна
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Model   string `json:"model"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", i.File, i.Line, i.Column, i.Severity, i.Message, i.Rule)
+}
+
+// reservedColumns - колонки, которые шаблон миграции добавляет каждой таблице
+var reservedColumns = map[string]bool{"created_at": true, "updated_at": true}
+
+// nolintPattern - подавление замечаний в комментарии к сообщению или полю:
+// appgen:nolint подавляет все правила, appgen:nolint:key-type,sql-reserved -
+// перечисленные. Подавление у сообщения действует и на его поля.
+var nolintPattern = regexp.MustCompile(`appgen:nolint(?::([a-z0-9,-]+))?`)
+
+// Lint разбирает proto файлы и проверяет модели до генерации. Ошибки
+// первичного ключа и ссылок, которые прервали бы генерацию, становятся
+// замечаниями. Замечания отсортированы по файлу и позиции.
+func (g *Generator) Lint(protoFiles []string) ([]LintIssue, error) {
+	g.parser.lint = true
+	defer func() { g.parser.lint = false }()
+
+	models, err := g.parseFiles(protoFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{byName: make(map[string]*Model), bySnakeName: make(map[string]*Model)}
+	for _, m := range models {
+		l.byName[m.Name] = m
+		l.bySnakeName[strcase.ToSnake(m.Name)] = m
+	}
+	for _, m := range models {
+		l.lintModel(m)
+	}
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		a, b := l.issues[i], l.issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.issues, nil
+}
+
+type linter struct {
+	byName      map[string]*Model
+	bySnakeName map[string]*Model
+	issues      []LintIssue
+}
+
+func (l *linter) lintModel(m *Model) {
+	l.lintKey(m)
+
+	if IsSQLReserved(m.Table) {
+		l.report(m, nil, "sql-reserved", "", "table name %q of %s is a reserved SQL keyword", m.Table, m.Name)
+	}
+
+	for _, f := range m.Fields {
+		column := strings.ToLower(f.DbName)
+		if reservedColumns[column] {
+			l.report(m, f, "reserved-column", "",
+				"field %s.%s clashes with the %s column generated for every table, rename it", m.Name, f.Name, column)
+		} else if IsSQLReserved(column) {
+			l.report(m, f, "sql-reserved", "", "column %q of %s is a reserved SQL keyword", column, m.Name)
+		}
+		// Повторяющиеся значения хранятся только как JSONB сообщений,
+		// для скаляров модель и конвертеры gRPC не генерируются
+		if f.Repeated && f.Value == nil {
+			l.report(m, f, "repeated-scalar", "",
+				"field %s.%s is %s; only repeated messages are supported, wrap the value in a message", m.Name, f.Name, protoType(f))
+		}
+		l.lintRef(m, f)
+	}
+}
+
+// lintKey разбирает ошибку первичного ключа, сохранённую парсером
+func (l *linter) lintKey(m *Model) {
+	if m.keyErr == nil {
+		return
+	}
+
+	var keyErr *protoload.KeyFieldError
+	switch {
+	case errors.As(m.keyErr, &keyErr) && keyErr.Missing:
+		l.report(m, nil, "missing-key", "",
+			"%s has no %s field, add it or list the key fields in (appgen.primary_key)", m.Name, keyErr.Field)
+	case errors.As(m.keyErr, &keyErr):
+		f := findField(m, keyErr.Field)
+		l.report(m, f, "key-type", "",
+			"key field %s.%s is %s, keys must be a singular int64 or string", m.Name, keyErr.Field, protoType(f))
+	default:
+		l.report(m, nil, "invalid-key", "", "%v", m.keyErr)
+	}
+}
+
+// lintRef проверяет ссылку поля так же, как linkModels при генерации
+func (l *linter) lintRef(m *Model, f *Field) {
+	var ref *Model
+	switch {
+	case f.RefName != "":
+		if ref = l.byName[f.RefName]; ref == nil {
+			l.report(m, f, "unknown-ref", SeverityError,
+				"field %s.%s refers to unknown entity %s", m.Name, f.Name, f.RefName)
+			return
+		}
+	case strings.HasSuffix(f.Name, "_id"):
+		name := strings.TrimSuffix(f.Name, "_id")
+		if ref = l.bySnakeName[name]; ref == nil {
+			l.report(m, f, "unknown-ref", "",
+				"field %s.%s looks like a reference, but there is no %s entity; set (appgen.field).ref or rename the field",
+				m.Name, f.Name, strcase.ToCamel(name))
+			return
+		}
+	default:
+		return
+	}
+
+	if ref.PK == nil || ref.PK.Composite() {
+		return
+	}
+	if key := ref.PK.Fields[0]; f.Type != key.Type || f.Repeated {
+		l.report(m, f, "ref-type", "",
+			"field %s.%s is %s, but the key %s.%s it refers to is %s",
+			m.Name, f.Name, protoType(f), ref.Name, key.Name, protoType(key))
+	}
+}
+
+// report добавляет замечание, если оно не подавлено комментарием. Пустая
+// severity означает важность правила по умолчанию.
+func (l *linter) report(m *Model, f *Field, rule string, severity Severity, format string, args ...interface{}) {
+	if suppressed(m.desc, rule) || (f != nil && suppressed(f.desc, rule)) {
+		return
+	}
+	if severity == "" {
+		severity = ruleSeverity(rule)
+	}
+
+	issue := LintIssue{
+		Rule:     rule,
+		Severity: severity,
+		File:     m.file,
+		Model:    m.Name,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	var desc protoreflect.Descriptor = m.desc
+	if f != nil {
+		issue.Field = f.Name
+		desc = f.desc
+	}
+	if desc != nil {
+		loc := desc.ParentFile().SourceLocations().ByDescriptor(desc)
+		issue.Line, issue.Column = loc.StartLine+1, loc.StartColumn+1
+	}
+	l.issues = append(l.issues, issue)
+}
+
+func ruleSeverity(id string) Severity {
+	for _, r := range LintRules {
+		if r.ID == id {
+			return r.Severity
+		}
+	}
+	return SeverityError
+}
+
+// suppressed сообщает, подавлено ли правило комментарием к объявлению
+func suppressed(desc protoreflect.Descriptor, rule string) bool {
+	if desc == nil {
+		return false
+	}
+	loc := desc.ParentFile().SourceLocations().ByDescriptor(desc)
+	for _, comment := range []string{loc.LeadingComments, loc.TrailingComments} {
+		for _, match := range nolintPattern.FindAllStringSubmatch(comment, -1) {
+			if match[1] == "" {
+				return true
+			}
+			for _, id := range strings.Split(match[1], ",") {
+				if id == rule {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// protoType возвращает тип поля, как он записан в proto
+func protoType(f *Field) string {
+	if f == nil || f.desc == nil {
+		return "unknown"
+	}
+	t := f.desc.Kind().String()
+	if f.desc.Message() != nil {
+		t = string(f.desc.Message().FullName())
+	}
+	if f.Repeated {
+		t = "repeated " + t
+	}
+	return t
+}
@@ -0,0 +1,187 @@
+package generator
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// lintProto проверяет proto файл с заголовком пакета shop и возвращает
+// замечания в виде "severity rule Model.field"
+func lintProto(t *testing.T, body string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	content := "syntax = \"proto3\";\npackage shop;\nimport \"appgen/options.proto\";\n\n" + body
+	path := filepath.Join(dir, "shop.proto")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := New(Options{ImportPaths: []string{dir}, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues, err := g.Lint([]string{path})
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+
+	var got []string
+	for _, issue := range issues {
+		subject := issue.Model
+		if issue.Field != "" {
+			subject += "." + issue.Field
+		}
+		got = append(got, string(issue.Severity)+" "+issue.Rule+" "+subject)
+	}
+	return got
+}
+
+func TestLint(t *testing.T) {
+	const region = `
+message Region {
+  option (appgen.entity) = true;
+  int64 id = 1;
+}
+`
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "valid entities",
+			body: region + `
+message Courier {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  string name = 2 [(appgen.field) = { required: true }];
+  int64 region_id = 3;
+}
+`,
+		},
+		{
+			name: "missing key",
+			body: `
+message Courier {
+  option (appgen.entity) = true;
+  string name = 1;
+}
+`,
+			want: []string{"error missing-key Courier"},
+		},
+		{
+			name: "key of unsupported type",
+			body: `
+message Courier {
+  option (appgen.entity) = true;
+  double id = 1;
+}
+`,
+			want: []string{"error key-type Courier.id"},
+		},
+		{
+			name: "key strategy that does not fit the key",
+			body: `
+message Courier {
+  option (appgen.entity) = true;
+  option (appgen.primary_key) = { fields: ["id"] strategy: UUID_V7 };
+  int64 id = 1;
+}
+`,
+			want: []string{"error invalid-key Courier"},
+		},
+		{
+			name: "reserved table and column names",
+			body: `
+message Courier {
+  option (appgen.entity) = true;
+  option (appgen.table) = "order";
+  int64 id = 1;
+  string user = 2;
+  string created_at = 3;
+}
+`,
+			want: []string{
+				"error sql-reserved Courier",
+				"error sql-reserved Courier.user",
+				"error reserved-column Courier.created_at",
+			},
+		},
+		{
+			name: "references to unknown entities",
+			body: `
+message Courier {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  int64 depot_id = 2;
+  int64 hub = 3 [(appgen.field) = { ref: "Hub" }];
+}
+`,
+			want: []string{
+				"warning unknown-ref Courier.depot_id",
+				"error unknown-ref Courier.hub",
+			},
+		},
+		{
+			name: "reference type differs from the key",
+			body: region + `
+message Courier {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  string region_id = 2;
+}
+`,
+			want: []string{"error ref-type Courier.region_id"},
+		},
+		{
+			name: "repeated scalars",
+			body: `
+message Tag {
+  string name = 1;
+}
+
+message Courier {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  repeated string phones = 2;
+  repeated Tag tags = 3;
+}
+`,
+			want: []string{"error repeated-scalar Courier.phones"},
+		},
+		{
+			name: "nolint comments",
+			body: `
+// appgen:nolint
+message Courier {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  string user = 2;
+}
+
+message Depot {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  // appgen:nolint:sql-reserved
+  string user = 2;
+  // appgen:nolint:unknown-ref
+  string order = 3;
+}
+`,
+			want: []string{"error sql-reserved Depot.order"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lintProto(t, tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
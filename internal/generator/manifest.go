@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+
+	"generator/internal/outfs"
+)
+
+// Служебные файлы генератора хранятся в скрытой директории внутри output
+const (
+	stateDir         = ".appgen"
+	manifestFileName = "manifest.json"
+	manifestVersion  = 1
+)
+
+// Manifest перечисляет файлы, которые создал генератор
+type Manifest struct {
+	Version int             `json:"version"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry описывает один сгенерированный файл
+type ManifestEntry struct {
+	Path     string `json:"path"`
+	Template string `json:"template"`
+	Model    string `json:"model,omitempty"`
+	Mode     string `json:"mode"`
+	Checksum string `json:"sha256"`
+}
+
+// Owned сообщает, перезаписывает ли генератор файл при каждом запуске.
+// Файлы в режиме create-only после создания принадлежат пользователю.
+func (e ManifestEntry) Owned() bool {
+	return e.Mode == modeOverwrite.String()
+}
+
+var manifestPath = path.Join(stateDir, manifestFileName)
+
+// LoadManifest читает манифест из выходной файловой системы.
+// Если манифеста ещё нет, возвращается пустой манифест.
+func LoadManifest(fsys fs.FS) (*Manifest, error) {
+	data, err := fs.ReadFile(fsys, manifestPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Manifest{Version: manifestVersion}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+
+	return &m, nil
+}
+
+// Save записывает манифест в выходную файловую систему
+func (m *Manifest) Save(dst outfs.FS) error {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := dst.WriteFile(manifestPath, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Lookup ищет запись о файле по пути относительно output директории
+func (m *Manifest) Lookup(path string) (ManifestEntry, bool) {
+	for _, e := range m.Files {
+		if e.Path == path {
+			return e, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
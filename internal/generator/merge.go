@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"strings"
+)
+
+// Маркеры конфликтов в формате diff3, который понимают git и редакторы
+const (
+	conflictOurs   = "<<<<<<< ours"
+	conflictBase   = "||||||| base"
+	conflictSplit  = "======="
+	conflictTheirs = ">>>>>>> generated"
+)
+
+// mergeMaxLines ограничивает размер участка, для которого строится LCS
+const mergeMaxLines = 8000
+
+// mergeResult - результат трёхстороннего слияния
+type mergeResult struct {
+	content   string
+	conflicts int
+}
+
+// merge3 выполняет построчное трёхстороннее слияние: base - прошлая
+// сгенерированная версия, ours - файл пользователя, theirs - новая версия
+func merge3(base, ours, theirs string) mergeResult {
+	o := splitLines(base)
+	a := splitLines(ours)
+	b := splitLines(theirs)
+
+	ma := matchLines(o, a)
+	mb := matchLines(o, b)
+
+	var out []string
+	conflicts := 0
+	i, j, k := 0, 0, 0
+
+	for {
+		// Стабильный участок: строки base совпадают в обеих версиях подряд
+		for i < len(o) && j < len(a) && k < len(b) && ma[i] == j && mb[i] == k {
+			out = append(out, o[i])
+			i++
+			j++
+			k++
+		}
+		if i == len(o) && j == len(a) && k == len(b) {
+			break
+		}
+
+		// Ищем следующую строку base, сохранившуюся в обеих версиях
+		ni := i
+		for ni < len(o) && (ma[ni] < 0 || mb[ni] < 0) {
+			ni++
+		}
+		nj, nk := len(a), len(b)
+		if ni < len(o) {
+			nj, nk = ma[ni], mb[ni]
+		}
+
+		baseChunk, oursChunk, theirsChunk := o[i:ni], a[j:nj], b[k:nk]
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			out = append(out, theirsChunk...)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			out = append(out, oursChunk...)
+		default:
+			conflicts++
+			out = append(out, conflictOurs)
+			out = append(out, oursChunk...)
+			out = append(out, conflictBase)
+			out = append(out, baseChunk...)
+			out = append(out, conflictSplit)
+			out = append(out, theirsChunk...)
+			out = append(out, conflictTheirs)
+		}
+
+		i, j, k = ni, nj, nk
+	}
+
+	return mergeResult{content: strings.Join(out, "\n"), conflicts: conflicts}
+}
+
+// matchLines строит LCS между base и other и возвращает для каждой строки
+// base индекс совпавшей строки в other или -1
+func matchLines(base, other []string) []int {
+	match := make([]int, len(base))
+	for i := range match {
+		match[i] = -1
+	}
+
+	// Общие начало и конец сопоставляем напрямую, чтобы уменьшить таблицу LCS
+	prefix := 0
+	for prefix < len(base) && prefix < len(other) && base[prefix] == other[prefix] {
+		match[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(other)-prefix &&
+		base[len(base)-1-suffix] == other[len(other)-1-suffix] {
+		match[len(base)-1-suffix] = len(other) - 1 - suffix
+		suffix++
+	}
+
+	x := base[prefix : len(base)-suffix]
+	y := other[prefix : len(other)-suffix]
+	if len(x) == 0 || len(y) == 0 {
+		return match
+	}
+	if len(x) > mergeMaxLines || len(y) > mergeMaxLines {
+		// Слишком большой участок: считаем его полностью изменённым
+		return match
+	}
+
+	// lcs[p][q] - длина LCS для x[p:] и y[q:]
+	lcs := make([][]int32, len(x)+1)
+	for p := range lcs {
+		lcs[p] = make([]int32, len(y)+1)
+	}
+	for p := len(x) - 1; p >= 0; p-- {
+		for q := len(y) - 1; q >= 0; q-- {
+			switch {
+			case x[p] == y[q]:
+				lcs[p][q] = lcs[p+1][q+1] + 1
+			case lcs[p+1][q] >= lcs[p][q+1]:
+				lcs[p][q] = lcs[p+1][q]
+			default:
+				lcs[p][q] = lcs[p][q+1]
+			}
+		}
+	}
+
+	for p, q := 0, 0; p < len(x) && q < len(y); {
+		switch {
+		case x[p] == y[q]:
+			match[prefix+p] = prefix + q
+			p++
+			q++
+		case lcs[p+1][q] >= lcs[p][q+1]:
+			p++
+		default:
+			q++
+		}
+	}
+
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return splitContentLines([]byte(s))
+}
@@ -0,0 +1,176 @@
+package generator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		want      string
+		conflicts int
+	}{
+		{
+			name:   "no changes",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "only generated changed",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nB\nc\n",
+			want:   "a\nB\nc\n",
+		},
+		{
+			name:   "only user changed",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb2\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nb2\nc\n",
+		},
+		{
+			name:   "changes in different places",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "a\nuser\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\ngenerated\n",
+			want:   "a\nuser\nc\nd\ngenerated\n",
+		},
+		{
+			name:   "same change on both sides",
+			base:   "a\nb\nc\n",
+			ours:   "a\nx\nc\n",
+			theirs: "a\nx\nc\n",
+			want:   "a\nx\nc\n",
+		},
+		{
+			name:   "user added lines, generated removed others",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nadded\nc\n",
+			theirs: "b\nc\n",
+			want:   "b\nadded\nc\n",
+		},
+		{
+			name:   "conflicting change",
+			base:   "a\nb\nc\n",
+			ours:   "a\nuser\nc\n",
+			theirs: "a\ngenerated\nc\n",
+			want: strings.Join([]string{
+				"a", conflictOurs, "user", conflictBase, "b", conflictSplit, "generated", conflictTheirs, "c", "",
+			}, "\n"),
+			conflicts: 1,
+		},
+		{
+			name:   "empty base",
+			base:   "",
+			ours:   "a\n",
+			theirs: "b\n",
+			want: strings.Join([]string{
+				conflictOurs, "a", "", conflictBase, conflictSplit, "b", "", conflictTheirs,
+			}, "\n"),
+			conflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := merge3(tt.base, tt.ours, tt.theirs)
+			if got.content != tt.want {
+				t.Errorf("content = %q, want %q", got.content, tt.want)
+			}
+			if got.conflicts != tt.conflicts {
+				t.Errorf("conflicts = %d, want %d", got.conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeRegions(t *testing.T) {
+	tests := []struct {
+		name         string
+		generated    string
+		old          string
+		want         string
+		wantOrphaned []string
+		wantErr      bool
+	}{
+		{
+			name:      "no regions in old file",
+			generated: "a\n// appgen:begin custom x\n// appgen:end\n",
+			old:       "old\n",
+			want:      "a\n// appgen:begin custom x\n// appgen:end\n",
+		},
+		{
+			name:      "region body is kept",
+			generated: "new\n// appgen:begin custom x\ndefault\n// appgen:end\n",
+			old:       "old\n// appgen:begin custom x\nuser code\n// appgen:end\n",
+			want:      "new\n// appgen:begin custom x\nuser code\n// appgen:end\n",
+		},
+		{
+			name:      "regions with the same name are matched in order",
+			generated: "// appgen:begin custom\n// appgen:end\n-- appgen:begin custom\n-- appgen:end\n",
+			old:       "// appgen:begin custom\nfirst\n// appgen:end\n-- appgen:begin custom\nsecond\n-- appgen:end\n",
+			want:      "// appgen:begin custom\nfirst\n// appgen:end\n-- appgen:begin custom\nsecond\n-- appgen:end\n",
+		},
+		{
+			name:         "region missing from generated file is orphaned",
+			generated:    "// appgen:begin custom a\n// appgen:end\n",
+			old:          "// appgen:begin custom a\n// appgen:end\n# appgen:begin custom gone\nlost\n# appgen:end\n",
+			want:         "// appgen:begin custom a\n// appgen:end\n",
+			wantOrphaned: []string{"gone"},
+		},
+		{
+			name:      "blank orphaned region is dropped silently",
+			generated: "// appgen:begin custom a\n// appgen:end\n",
+			old:       "// appgen:begin custom a\n// appgen:end\n// appgen:begin custom b\n\n// appgen:end\n",
+			want:      "// appgen:begin custom a\n// appgen:end\n",
+		},
+		{
+			name:         "marker outside a comment is ignored",
+			generated:    "x := \"appgen:begin custom a\"\n",
+			old:          "// appgen:begin custom a\nkept\n// appgen:end\n",
+			want:         "x := \"appgen:begin custom a\"\n",
+			wantOrphaned: []string{"a"},
+		},
+		{
+			name:      "unclosed region in old file",
+			generated: "a\n",
+			old:       "// appgen:begin custom a\n",
+			wantErr:   true,
+		},
+		{
+			name:      "nested region in generated file",
+			generated: "// appgen:begin custom a\n// appgen:begin custom b\n// appgen:end\n// appgen:end\n",
+			old:       "// appgen:begin custom a\n// appgen:end\n",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, orphaned, err := mergeRegions([]byte(tt.generated), []byte(tt.old))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("mergeRegions() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeRegions() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(orphaned, tt.wantOrphaned) {
+				t.Errorf("orphaned = %v, want %v", orphaned, tt.wantOrphaned)
+			}
+		})
+	}
+}
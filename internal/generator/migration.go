@@ -0,0 +1,499 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"generator/internal/outfs"
+)
+
+// migrationKind - вид миграции модели
+type migrationKind struct {
+	template string
+	// suffix - окончание имени файла после версии, %s - имя модели
+	suffix string
+}
+
+var (
+	// functionsMigration создаёт общую для всех таблиц функцию триггера
+	// updated_at; она идёт первой, поэтому откатывается последней
+	functionsMigration   = migrationKind{template: "migration_functions.sql.tmpl", suffix: "_create_updated_at_function.sql"}
+	createMigration      = migrationKind{template: "migration.sql.tmpl", suffix: "_create_%s.sql"}
+	foreignKeysMigration = migrationKind{template: "migration_fk.sql.tmpl", suffix: "_add_%s_foreign_keys.sql"}
+	alterMigration       = migrationKind{template: "migration_alter.sql.tmpl", suffix: "_alter_%s.sql"}
+)
+
+var migrationKinds = []migrationKind{createMigration, foreignKeysMigration, alterMigration}
+
+// file возвращает окончание имени файла миграции модели name
+func (k migrationKind) file(name string) string {
+	if !strings.Contains(k.suffix, "%s") {
+		return k.suffix
+	}
+	return fmt.Sprintf(k.suffix, strings.ToLower(name))
+}
+
+// appliedSchemaPath - таблицы моделей в том виде, в каком их создают уже
+// выпущенные миграции. Выпущенная миграция могла быть применена, поэтому
+// генератор её не переписывает, а изменения модели относительно этой
+// схемы выпускает новой миграцией ALTER.
+var appliedSchemaPath = path.Join(stateDir, "tables.json")
+
+const appliedSchemaVersion = 1
+
+type appliedSchema struct {
+	Version int           `json:"version"`
+	Tables  []SchemaTable `json:"tables"`
+}
+
+// loadAppliedSchema читает схему выпущенных миграций. Если её ещё нет,
+// возвращается пустая схема.
+func loadAppliedSchema(fsys fs.FS) (*appliedSchema, error) {
+	data, err := fs.ReadFile(fsys, appliedSchemaPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &appliedSchema{Version: appliedSchemaVersion}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", appliedSchemaPath, err)
+	}
+
+	var s appliedSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", appliedSchemaPath, err)
+	}
+	if s.Version != appliedSchemaVersion {
+		return nil, fmt.Errorf("unsupported %s version %d", appliedSchemaPath, s.Version)
+	}
+	return &s, nil
+}
+
+func (s *appliedSchema) table(model string) (SchemaTable, bool) {
+	for _, t := range s.Tables {
+		if t.Model == model {
+			return t, true
+		}
+	}
+	return SchemaTable{}, false
+}
+
+func (s *appliedSchema) set(table SchemaTable) {
+	for i, t := range s.Tables {
+		if t.Model == table.Model {
+			s.Tables[i] = table
+			return
+		}
+	}
+	s.Tables = append(s.Tables, table)
+}
+
+func (s *appliedSchema) save(dst outfs.FS) error {
+	sort.Slice(s.Tables, func(i, j int) bool { return s.Tables[i].Model < s.Tables[j].Model })
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", appliedSchemaPath, err)
+	}
+	if err := dst.WriteFile(appliedSchemaPath, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", appliedSchemaPath, err)
+	}
+	return nil
+}
+
+// generateFunctionsMigration пишет миграцию общей функции триггера
+// updated_at, если её ещё нет. Таблицы удаляют только свои триггеры, а
+// функцию удаляет эта миграция, откатываясь последней.
+func (g *Generator) generateFunctionsMigration(dst outfs.FS) error {
+	existing, err := fs.Glob(dst, "migrations/*"+functionsMigration.suffix)
+	if err != nil {
+		return fmt.Errorf("failed to look up existing migrations: %w", err)
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	// В проектах, созданных раньше, функцию уже создали миграции таблиц, и
+	// эта миграция оказывается последней: при откате она удаляет функцию
+	// вместе с триггерами, которые на неё ссылаются
+	tables, err := fs.Glob(dst, "migrations/*_create_*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to look up existing migrations: %w", err)
+	}
+	data := struct{ Cascade bool }{Cascade: len(tables) > 0}
+	return g.writeMigration("", data, dst, -1, functionsMigration)
+}
+
+// generateCreateMigration пишет миграцию создания таблицы модели, если её
+// ещё нет, и сообщает, создана ли она этим запуском
+func (g *Generator) generateCreateMigration(model *Model, dst outfs.FS, index int) (bool, error) {
+	migrations, err := g.carryMigrations(model, dst)
+	if err != nil {
+		return false, err
+	}
+
+	created, ok := migrations[createMigration]
+	if !ok {
+		if err := g.writeMigration(model.Name, model, dst, index, createMigration); err != nil {
+			return false, err
+		}
+		g.applied.set(schemaTable(model))
+		return true, nil
+	}
+
+	// Проекты, созданные до появления схемы выпущенных миграций: схема
+	// берётся из самих миграций, которые генератор писал в известном виде
+	if _, ok := g.applied.table(model.Name); !ok {
+		if alter, ok := migrations[alterMigration]; ok {
+			return false, fmt.Errorf("%s is missing, but %s was already generated from it; restore %s from version control",
+				appliedSchemaPath, alter, appliedSchemaPath)
+		}
+		table, err := readMigrationTable(dst, created, migrations[foreignKeysMigration])
+		if err != nil {
+			return false, err
+		}
+		table.Model = model.Name
+		g.applied.set(table)
+	}
+	return false, nil
+}
+
+// generateAlterMigration пишет миграцию ALTER, если таблица модели
+// отличается от созданной выпущенными миграциями
+func (g *Generator) generateAlterMigration(model *Model, dst outfs.FS, index int) error {
+	old, _ := g.applied.table(model.Name)
+	next := schemaTable(model)
+	alter := diffTable(model, old, next)
+	if alter.empty() {
+		return nil
+	}
+	if len(alter.unfilled) > 0 {
+		return fmt.Errorf("columns %s of %s become NOT NULL, but existing rows have no value for them; "+
+			"add them as optional, fill them in and make them required in a later change (appgen breaking lists such changes)",
+			strings.Join(alter.unfilled, ", "), next.Name)
+	}
+	if err := g.writeMigration(model.Name, alter, dst, index, alterMigration); err != nil {
+		return err
+	}
+	g.applied.set(next)
+	return nil
+}
+
+// writeMigration пишет новую миграцию. Все миграции запуска получают одну
+// метку времени, порядок внутри запуска задаёт индекс.
+func (g *Generator) writeMigration(name string, data interface{}, dst outfs.FS, index int, kind migrationKind) error {
+	version := fmt.Sprintf("%s%02d", g.migrationTime, index+1)
+	filename := version + kind.file(name)
+
+	content, err := g.template.render(kind.template, data)
+	if err != nil {
+		return fmt.Errorf("failed to generate migration file: %w", err)
+	}
+
+	out := output{template: kind.template, path: "migrations/" + filename, mode: modeCreateOnly}
+	if err := g.writeFile(dst, out, name, content); err != nil {
+		return fmt.Errorf("failed to write migration file: %w", err)
+	}
+	return nil
+}
+
+// migrationStamp возвращает метку времени для миграций запуска. Метка
+// должна быть позже уже выпущенных миграций, даже если предыдущий запуск
+// пришёлся на ту же секунду.
+func migrationStamp(dst outfs.FS) (string, error) {
+	const layout = "20060102150405"
+	stamp := time.Now()
+	paths, err := fs.Glob(dst, "migrations/*.sql")
+	if err != nil {
+		return "", fmt.Errorf("failed to look up existing migrations: %w", err)
+	}
+	if len(paths) > 0 {
+		// fs.Glob возвращает пути по порядку версий
+		name := path.Base(paths[len(paths)-1])
+		if len(name) >= len(layout) {
+			last, err := time.ParseInLocation(layout, name[:len(layout)], time.Local)
+			if err == nil && stamp.Before(last.Add(time.Second)) {
+				stamp = last.Add(time.Second)
+			}
+		}
+	}
+	return stamp.Format(layout), nil
+}
+
+// carryMigrations записывает в манифест уже выпущенные миграции модели и
+// возвращает последнюю миграцию каждого вида. Миграции записываются как
+// create-only: генератор их больше не меняет и не удаляет.
+func (g *Generator) carryMigrations(model *Model, dst outfs.FS) (map[migrationKind]string, error) {
+	latest := make(map[migrationKind]string)
+	for _, kind := range migrationKinds {
+		paths, err := fs.Glob(dst, "migrations/*"+kind.file(model.Name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up existing migrations: %w", err)
+		}
+		for _, p := range paths {
+			latest[kind] = p // fs.Glob возвращает пути по порядку версий
+			if _, ok := g.manifest.Lookup(p); ok {
+				continue
+			}
+
+			entry, ok := g.previous.Lookup(p)
+			if !ok {
+				content, err := fs.ReadFile(dst, p)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", p, err)
+				}
+				entry = ManifestEntry{Path: p, Template: kind.template, Model: model.Name, Checksum: checksum(content)}
+			}
+			entry.Mode = modeCreateOnly.String()
+			g.manifest.Files = append(g.manifest.Files, entry)
+		}
+	}
+	return latest, nil
+}
+
+// keepMigrations переносит в манифест выпущенные миграции, которых в нём
+// ещё нет, в том числе миграции удалённых моделей, и помечает все миграции
+// как create-only, чтобы они не удалялись как устаревшие
+func (g *Generator) keepMigrations(dst outfs.FS) {
+	for _, prev := range g.previous.Files {
+		if !strings.HasPrefix(prev.Path, "migrations/") {
+			continue
+		}
+		if _, ok := g.manifest.Lookup(prev.Path); ok {
+			continue
+		}
+		if _, err := fs.Stat(dst, prev.Path); err == nil {
+			g.manifest.Files = append(g.manifest.Files, prev)
+		}
+	}
+	for i, entry := range g.manifest.Files {
+		if strings.HasPrefix(entry.Path, "migrations/") {
+			g.manifest.Files[i].Mode = modeCreateOnly.String()
+		}
+	}
+}
+
+// alterTable - изменения таблицы модели для шаблона migration_alter.sql.tmpl
+type alterTable struct {
+	Model *Model
+	Table string
+	// OldTable - прежнее имя переименованной таблицы
+	OldTable string
+	Added    []*Field
+	Dropped  []SchemaColumn
+	Altered  []alteredColumn
+	// RefsAdded - поля, у которых появился или сменился внешний ключ
+	RefsAdded []*Field
+	// RefsDropped - оставшиеся колонки, у которых пропал или сменился
+	// внешний ключ, в прежнем виде
+	RefsDropped []SchemaColumn
+	// OldKey, NewKey - колонки первичного ключа, если он изменился
+	OldKey, NewKey string
+	// KeyConstraint - имя ограничения первичного ключа в базе
+	KeyConstraint string
+	// Backfill - значения для существующих строк по именам колонок,
+	// которые становятся NOT NULL без значения по умолчанию
+	Backfill map[string]string
+
+	// unfilled - такие колонки, для которых значения подобрать нельзя
+	unfilled []string
+}
+
+// alteredColumn - колонка, у которой изменился тип или NOT NULL
+type alteredColumn struct {
+	Name     string
+	Old, New SchemaColumn
+}
+
+// TypeChanged сообщает, изменился ли тип колонки. Переход между serial и
+// обычным целым типом той же ширины типом не считается.
+func (c alteredColumn) TypeChanged() bool {
+	return columnType(c.Old.Type) != columnType(c.New.Type)
+}
+
+func (c alteredColumn) OldType() string { return columnType(c.Old.Type) }
+func (c alteredColumn) NewType() string { return columnType(c.New.Type) }
+
+// columnType возвращает тип колонки для ALTER COLUMN TYPE: serial типы
+// существуют только в CREATE TABLE и ADD COLUMN
+func columnType(sqlType string) string {
+	switch strings.ToUpper(sqlType) {
+	case "BIGSERIAL":
+		return "BIGINT"
+	case "SERIAL":
+		return "INTEGER"
+	case "SMALLSERIAL":
+		return "SMALLINT"
+	default:
+		return sqlType
+	}
+}
+
+func (a *alterTable) empty() bool {
+	return a.OldTable == "" && len(a.Added) == 0 && len(a.Dropped) == 0 && len(a.Altered) == 0 &&
+		len(a.RefsAdded) == 0 && len(a.RefsDropped) == 0 && a.OldKey == a.NewKey
+}
+
+// diffTable сравнивает таблицу old, созданную выпущенными миграциями, с
+// таблицей next текущей модели
+func diffTable(model *Model, old, next SchemaTable) *alterTable {
+	alter := &alterTable{Model: model, Table: next.Name, KeyConstraint: old.Name + "_pkey", Backfill: make(map[string]string)}
+	if old.Name != next.Name {
+		alter.OldTable = old.Name
+	}
+
+	oldColumns := make(map[string]SchemaColumn, len(old.Columns))
+	for _, c := range old.Columns {
+		oldColumns[c.Name] = c
+	}
+	nextColumns := make(map[string]bool, len(next.Columns))
+	for i, c := range next.Columns {
+		nextColumns[c.Name] = true
+		f := model.Fields[i]
+		prev, ok := oldColumns[c.Name]
+		if !ok {
+			alter.Added = append(alter.Added, f)
+			if c.NotNull && !c.Default {
+				alter.backfill(c)
+			}
+			if c.References != "" {
+				alter.RefsAdded = append(alter.RefsAdded, f)
+			}
+			continue
+		}
+		if columnType(prev.Type) != columnType(c.Type) || prev.NotNull != c.NotNull {
+			alter.Altered = append(alter.Altered, alteredColumn{Name: c.Name, Old: prev, New: c})
+			if c.NotNull && !prev.NotNull {
+				alter.backfill(c)
+			}
+		}
+		if prev.References != c.References {
+			if prev.References != "" {
+				alter.RefsDropped = append(alter.RefsDropped, prev)
+			}
+			if c.References != "" {
+				alter.RefsAdded = append(alter.RefsAdded, f)
+			}
+		}
+	}
+	for _, c := range old.Columns {
+		if !nextColumns[c.Name] {
+			alter.Dropped = append(alter.Dropped, c)
+		}
+	}
+
+	alter.OldKey, alter.NewKey = keyColumns(old), keyColumns(next)
+	return alter
+}
+
+// backfill подбирает значение для существующих строк колонки, которая
+// становится NOT NULL. Ссылкам и ключам подходящего значения нет.
+func (a *alterTable) backfill(c SchemaColumn) {
+	if value, ok := backfillValue(c); ok {
+		a.Backfill[c.Name] = value
+		return
+	}
+	a.unfilled = append(a.unfilled, c.Name)
+}
+
+// backfillValue возвращает нулевое значение типа колонки
+func backfillValue(c SchemaColumn) (string, bool) {
+	if c.References != "" || c.PrimaryKey {
+		return "", false
+	}
+	switch t := strings.ToUpper(columnType(c.Type)); {
+	case t == "TEXT" || strings.HasPrefix(t, "CHAR") || strings.HasPrefix(t, "VARCHAR"):
+		return "''", true
+	case t == "BIGINT" || t == "INTEGER" || t == "SMALLINT" || t == "REAL" || t == "DOUBLE PRECISION":
+		return "0", true
+	case t == "BOOLEAN":
+		return "FALSE", true
+	case t == "BYTEA":
+		return "''::bytea", true
+	case t == "TIMESTAMPTZ":
+		return "CURRENT_TIMESTAMP", true
+	case t == "JSONB":
+		return "'null'::jsonb", true
+	}
+	return "", false
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?m)^CREATE TABLE (?:IF NOT EXISTS )?(\w+) \($`)
+	primaryKeyPattern  = regexp.MustCompile(`^PRIMARY KEY \(([^)]*)\)`)
+	referencesPattern  = regexp.MustCompile(`REFERENCES (\w+\([^)]*\))`)
+	foreignKeyPattern  = regexp.MustCompile(`FOREIGN KEY \((\w+)\)\s+REFERENCES (\w+\([^)]*\))`)
+)
+
+// readMigrationTable восстанавливает таблицу по миграции создания и
+// миграции отложенных внешних ключей, записанным генератором
+func readMigrationTable(fsys fs.FS, createPath, foreignKeysPath string) (SchemaTable, error) {
+	content, err := fs.ReadFile(fsys, createPath)
+	if err != nil {
+		return SchemaTable{}, fmt.Errorf("failed to read %s: %w", createPath, err)
+	}
+	match := createTablePattern.FindSubmatchIndex(content)
+	if match == nil {
+		return SchemaTable{}, fmt.Errorf("%s has no CREATE TABLE statement, restore it or write the ALTER migration by hand", createPath)
+	}
+
+	table := SchemaTable{Name: string(content[match[2]:match[3]]), Columns: []SchemaColumn{}}
+	for _, line := range strings.Split(string(content[match[1]:]), "\n") {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ")") {
+			break
+		}
+		if m := primaryKeyPattern.FindStringSubmatch(line); m != nil {
+			for _, name := range strings.Split(m[1], ",") {
+				for i := range table.Columns {
+					if table.Columns[i].Name == strings.TrimSpace(name) {
+						table.Columns[i].PrimaryKey = true
+					}
+				}
+			}
+			continue
+		}
+
+		name, definition, _ := strings.Cut(line, " ")
+		if reservedColumns[name] {
+			continue
+		}
+		column := SchemaColumn{
+			Name:    name,
+			Type:    definition,
+			NotNull: strings.Contains(definition, " NOT NULL"),
+			Default: strings.Contains(definition, " DEFAULT ") || strings.Contains(definition, "SERIAL"),
+		}
+		for _, keyword := range []string{" DEFAULT ", " NOT NULL", " REFERENCES "} {
+			if i := strings.Index(column.Type, keyword); i >= 0 {
+				column.Type = column.Type[:i]
+			}
+		}
+		if m := referencesPattern.FindStringSubmatch(definition); m != nil {
+			column.References = m[1]
+		}
+		table.Columns = append(table.Columns, column)
+	}
+
+	if foreignKeysPath != "" {
+		content, err := fs.ReadFile(fsys, foreignKeysPath)
+		if err != nil {
+			return SchemaTable{}, fmt.Errorf("failed to read %s: %w", foreignKeysPath, err)
+		}
+		for _, m := range foreignKeyPattern.FindAllStringSubmatch(string(content), -1) {
+			for i := range table.Columns {
+				if table.Columns[i].Name == m[1] {
+					table.Columns[i].References = m[2]
+				}
+			}
+		}
+	}
+	return table, nil
+}
@@ -1,8 +1,88 @@
 package generator
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"generator/internal/protoload"
+)
+
 type Model struct {
-	Name   string
+	Name string
+	// Table - имя таблицы (по умолчанию snake_case во множественном числе)
+	Table string
+	// Resource - имя ресурса в REST путях (по умолчанию kebab-case во множественном числе)
+	Resource string
+	// API - стандартные и пользовательские методы сущности, (appgen.api)
+	API    protoload.API
+	Fields []*Field
+	// RPCs - пользовательские методы из сервиса <Model>Service исходного файла
+	RPCs []*RPC
+	// PK - первичный ключ, (appgen.primary_key)
+	PK *PrimaryKey
+
+	// file - исходный proto файл, desc - сообщение модели в нём
+	file string
+	desc protoreflect.MessageDescriptor
+	// keyErr - ошибка первичного ключа при разборе для appgen lint,
+	// PK в этом случае пуст
+	keyErr error
+}
+
+// PrimaryKey - первичный ключ модели
+type PrimaryKey struct {
 	Fields []*Field
+	// Strategy - db, uuidv7, ulid или natural
+	Strategy string
+}
+
+// Composite сообщает, состоит ли ключ из нескольких полей
+func (k *PrimaryKey) Composite() bool {
+	return len(k.Fields) > 1
+}
+
+// Columns возвращает колонки ключа через запятую
+func (k *PrimaryKey) Columns() string {
+	columns := make([]string, len(k.Fields))
+	for i, f := range k.Fields {
+		columns[i] = strings.ToLower(f.DbName)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// KeyParams возвращает параметры функции для значений ключа: "id int64"
+func (m *Model) KeyParams() string {
+	params := make([]string, len(m.PK.Fields))
+	for i, f := range m.PK.Fields {
+		params[i] = f.Param() + " " + f.Type
+	}
+	return strings.Join(params, ", ")
+}
+
+// KeyArgs возвращает аргументы вызова со значениями ключа: "id"
+func (m *Model) KeyArgs() string {
+	args := make([]string, len(m.PK.Fields))
+	for i, f := range m.PK.Fields {
+		args[i] = f.Param()
+	}
+	return strings.Join(args, ", ")
+}
+
+// KeyValues возвращает значения ключа из полей переменной: KeyValues "req" -> "req.Id"
+func (m *Model) KeyValues(v string) string {
+	values := make([]string, len(m.PK.Fields))
+	for i, f := range m.PK.Fields {
+		values[i] = v + "." + strcase.ToCamel(f.Name)
+	}
+	return strings.Join(values, ", ")
+}
+
+// KeyType возвращает Go тип ключа из одного поля
+func (m *Model) KeyType() string {
+	return m.PK.Fields[0].Type
 }
 
 type Field struct {
@@ -13,4 +93,231 @@ type Field struct {
 	SqlType     string
 	Last        bool
 	Validations []string
+
+	// Repeated - повторяющееся поле
+	Repeated bool
+	// Timestamp - поле google.protobuf.Timestamp, в модели time.Time
+	Timestamp bool
+	// Value - тип-значение поля, хранится в JSONB колонке
+	Value *ValueType
+	// Enum - Go тип перечисления в пакете proto; в модели поле int32
+	Enum string
+
+	// Required - поле обязательно, (appgen.field).required
+	Required bool
+
+	// Key - поле входит в первичный ключ
+	Key bool
+	// DBGenerated - значение поля генерирует база данных
+	DBGenerated bool
+	// SqlDefault - выражение DEFAULT колонки
+	SqlDefault string
+
+	// Ref - модель, на которую ссылается поле из (appgen.field).ref или
+	// поле вида <model>_id
+	Ref *Model
+	// RefName - имя модели из (appgen.field).ref
+	RefName string
+	// Deferred - внешний ключ поля создаётся отдельной миграцией после всех
+	// таблиц, потому что ссылка замыкает цикл
+	Deferred bool
+
+	desc protoreflect.FieldDescriptor
+}
+
+// Param возвращает имя параметра функции для значения поля
+func (f *Field) Param() string {
+	return goIdent(strcase.ToLowerCamel(f.Name))
+}
+
+// Nullable сообщает, хранится ли поле в модели указателем. Необязательная
+// ссылка без значения пишется в базу как NULL: нулевой ключ отклонил бы
+// внешний ключ, и ON DELETE SET NULL возвращается в модель как nil.
+func (f *Field) Nullable() bool {
+	return f.Ref != nil && !f.Required && !f.Key && !f.Repeated
+}
+
+// ModelType возвращает Go тип поля в структуре модели
+func (f *Field) ModelType() string {
+	if f.Nullable() {
+		return "*" + f.Type
+	}
+	return f.Type
+}
+
+// Zero возвращает нулевое значение типа поля в Go
+func (f *Field) Zero() string {
+	switch f.Type {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	case "int64", "int32", "uint64", "uint32", "float64", "float32":
+		return "0"
+	default:
+		return "nil"
+	}
+}
+
+// Missing возвращает условие Go, истинное, если поле сообщения proto v
+// не заполнено
+func (f *Field) Missing(v string) string {
+	x := v + "." + strcase.ToCamel(f.Name)
+	switch {
+	case f.Repeated:
+		return "len(" + x + ") == 0"
+	case f.Value != nil || f.Timestamp:
+		return x + " == nil"
+	case f.Type == "bool":
+		return "!" + x
+	case f.Type == "string", f.Type == "[]byte":
+		return "len(" + x + ") == 0"
+	default:
+		return x + " == 0"
+	}
+}
+
+// RequiredFields возвращает обязательные поля модели, кроме ключа
+func (m *Model) RequiredFields() []*Field {
+	var result []*Field
+	for _, f := range m.Fields {
+		if f.Required && !f.Key {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// ValueType - сообщение, которое не является сущностью. В моделях это
+// обычная структура, в базе - JSONB колонка поля сущности.
+type ValueType struct {
+	Name string
+	// ProtoName - имя типа в сгенерированном пакете proto (Order_Item)
+	ProtoName string
+	Fields    []*Field
+}
+
+// ValueTypes возвращает типы-значения, используемые полями модели,
+// включая вложенные
+func (m *Model) ValueTypes() []*ValueType {
+	return collectValueTypes(m.Fields, nil)
+}
+
+// UsesTimestamp сообщает, есть ли у модели или её типов-значений поля времени
+func (m *Model) UsesTimestamp() bool {
+	if hasTimestamp(m.Fields) {
+		return true
+	}
+	for _, vt := range m.ValueTypes() {
+		if hasTimestamp(vt.Fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// UsesTimestamp сообщает, есть ли у типа-значения поля времени
+func (vt *ValueType) UsesTimestamp() bool {
+	return hasTimestamp(vt.Fields)
+}
+
+func hasTimestamp(fields []*Field) bool {
+	for _, f := range fields {
+		if f.Timestamp {
+			return true
+		}
+	}
+	return false
+}
+
+func collectValueTypes(fields []*Field, seen []*ValueType) []*ValueType {
+	for _, f := range fields {
+		if f.Value == nil || containsValueType(seen, f.Value) {
+			continue
+		}
+		seen = append(seen, f.Value)
+		seen = collectValueTypes(f.Value.Fields, seen)
+	}
+	return seen
+}
+
+func containsValueType(types []*ValueType, vt *ValueType) bool {
+	for _, t := range types {
+		if t == vt {
+			return true
+		}
+	}
+	return false
+}
+
+// linkModels связывает поля-ссылки с моделями, на которые они указывают:
+// поля с (appgen.field).ref и поля вида <model>_id. Колонка ссылки получает
+// тип ключа модели; ссылаться можно только на модели с ключом из одного поля.
+func linkModels(models []*Model) error {
+	byName := make(map[string]*Model, len(models))
+	bySnakeName := make(map[string]*Model, len(models))
+	for _, m := range models {
+		byName[m.Name] = m
+		bySnakeName[strcase.ToSnake(m.Name)] = m
+	}
+
+	for _, m := range models {
+		for _, f := range m.Fields {
+			f.Ref = nil
+			f.Deferred = false
+
+			var ref *Model
+			switch {
+			case f.RefName != "":
+				ref = byName[f.RefName]
+				if ref == nil {
+					return fmt.Errorf("field %s.%s refers to unknown entity %s", m.Name, f.Name, f.RefName)
+				}
+				if ref.PK.Composite() {
+					return fmt.Errorf("field %s.%s refers to %s, which has a composite key", m.Name, f.Name, ref.Name)
+				}
+				if f.Repeated {
+					return fmt.Errorf("field %s.%s: repeated fields cannot be references", m.Name, f.Name)
+				}
+			case strings.HasSuffix(f.Name, "_id"):
+				ref = bySnakeName[strings.TrimSuffix(f.Name, "_id")]
+				if ref == nil || ref.PK.Composite() {
+					continue
+				}
+			default:
+				continue
+			}
+
+			key := ref.PK.Fields[0]
+			if f.Type != key.Type {
+				return fmt.Errorf("field %s.%s is %s, but the key %s.%s it refers to is %s",
+					m.Name, f.Name, f.Type, ref.Name, key.Name, key.Type)
+			}
+			f.Ref = ref
+			if !f.Key || m.PK.Strategy == string(protoload.KeyNatural) {
+				f.SqlType = refSqlType(key)
+			}
+		}
+	}
+	return nil
+}
+
+// DeferredRefs возвращает поля, внешние ключи которых создаются отдельной
+// миграцией, чтобы разорвать цикл ссылок
+func (m *Model) DeferredRefs() []*Field {
+	var result []*Field
+	for _, f := range m.Fields {
+		if f.Ref != nil && f.Deferred {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// refSqlType возвращает тип колонки, ссылающейся на поле ключа
+func refSqlType(key *Field) string {
+	if key.SqlType == "BIGSERIAL" {
+		return "BIGINT"
+	}
+	return key.SqlType
 }
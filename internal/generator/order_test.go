@@ -0,0 +1,157 @@
+package generator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRef - ссылочное поле модели в описании теста
+type testRef struct {
+	model, field, target string
+	required             bool
+}
+
+// testModels строит модели с полями ссылок в порядке names
+func testModels(names []string, refs []testRef) []*Model {
+	byName := make(map[string]*Model, len(names))
+	var models []*Model
+	for _, name := range names {
+		m := &Model{Name: name, Fields: []*Field{{Name: "id", Key: true}}}
+		byName[name] = m
+		models = append(models, m)
+	}
+	for _, r := range refs {
+		m := byName[r.model]
+		m.Fields = append(m.Fields, &Field{Name: r.field, Ref: byName[r.target], Required: r.required})
+	}
+	return models
+}
+
+func TestOrderModels(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		refs  []testRef
+		want  []string
+		// deferred - отложенные ссылки в виде Model.field
+		deferred []string
+		// cycle - ожидаемая ошибка: модели и поля цикла
+		cycle *CycleError
+	}{
+		{
+			name:  "independent models keep their order",
+			names: []string{"Region", "Courier"},
+			want:  []string{"Region", "Courier"},
+		},
+		{
+			name:  "dependencies come first",
+			names: []string{"Order", "Courier", "Region"},
+			refs: []testRef{
+				{"Order", "courier_id", "Courier", true},
+				{"Courier", "region_id", "Region", false},
+			},
+			want: []string{"Region", "Courier", "Order"},
+		},
+		{
+			name:  "self reference does not defer",
+			names: []string{"Category"},
+			refs:  []testRef{{"Category", "parent_id", "Category", false}},
+			want:  []string{"Category"},
+		},
+		{
+			name:  "optional reference breaks a cycle",
+			names: []string{"Courier", "Vehicle"},
+			refs: []testRef{
+				{"Courier", "vehicle_id", "Vehicle", false},
+				{"Vehicle", "courier_id", "Courier", true},
+			},
+			want:     []string{"Courier", "Vehicle"},
+			deferred: []string{"Courier.vehicle_id"},
+		},
+		{
+			name:  "closing reference is deferred first",
+			names: []string{"A", "B", "C"},
+			refs: []testRef{
+				{"A", "b_id", "B", false},
+				{"B", "c_id", "C", false},
+				{"C", "a_id", "A", false},
+			},
+			want:     []string{"C", "B", "A"},
+			deferred: []string{"C.a_id"},
+		},
+		{
+			name:  "required cycle",
+			names: []string{"Courier", "Vehicle"},
+			refs: []testRef{
+				{"Courier", "vehicle_id", "Vehicle", true},
+				{"Vehicle", "courier_id", "Courier", true},
+			},
+			cycle: &CycleError{
+				Models: []string{"Courier", "Vehicle", "Courier"},
+				Fields: []string{"vehicle_id", "courier_id"},
+			},
+		},
+		{
+			name:  "required cycle behind an acyclic model",
+			names: []string{"Order", "A", "B"},
+			refs: []testRef{
+				{"Order", "a_id", "A", false},
+				{"A", "b_id", "B", true},
+				{"B", "a_id", "A", true},
+			},
+			cycle: &CycleError{
+				Models: []string{"A", "B", "A"},
+				Fields: []string{"b_id", "a_id"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := testModels(tt.names, tt.refs)
+			sorted, err := orderModels(models)
+
+			if tt.cycle != nil {
+				var cycleErr *CycleError
+				if !errors.As(err, &cycleErr) {
+					t.Fatalf("orderModels() error = %v, want *CycleError", err)
+				}
+				if !reflect.DeepEqual(cycleErr, tt.cycle) {
+					t.Errorf("cycle = %+v, want %+v", cycleErr, tt.cycle)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("orderModels() error = %v", err)
+			}
+
+			if got := modelNames(sorted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+			var deferred []string
+			for _, m := range models {
+				for _, f := range m.Fields {
+					if f.Deferred {
+						deferred = append(deferred, m.Name+"."+f.Name)
+					}
+				}
+			}
+			if !reflect.DeepEqual(deferred, tt.deferred) {
+				t.Errorf("deferred = %v, want %v", deferred, tt.deferred)
+			}
+		})
+	}
+}
+
+func TestCycleErrorMessage(t *testing.T) {
+	err := &CycleError{
+		Models: []string{"A", "B", "C", "A"},
+		Fields: []string{"b_id", "c_id", "a_id"},
+	}
+	want := "circular reference A.b_id -> B.c_id -> C.a_id -> A"
+	if got := err.Error(); !strings.HasPrefix(got, want) {
+		t.Errorf("Error() = %q, want prefix %q", got, want)
+	}
+}
@@ -0,0 +1,233 @@
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"path"
+	"strings"
+
+	"generator/internal/outfs"
+)
+
+// writeMode определяет, как генератор обращается с уже существующим файлом
+type writeMode int
+
+const (
+	// modeOverwrite перезаписывает файл при каждом запуске,
+	// сохраняя содержимое защищённых областей
+	modeOverwrite writeMode = iota
+	// modeCreateOnly создаёт файл только если его ещё нет
+	modeCreateOnly
+)
+
+func (m writeMode) String() string {
+	switch m {
+	case modeCreateOnly:
+		return "create-only"
+	default:
+		return "overwrite"
+	}
+}
+
+// output связывает шаблон с путём файла относительно output директории.
+// В путях моделей и сервисов {name} заменяется на имя в нижнем регистре.
+type output struct {
+	template string
+	path     string
+	mode     writeMode
+	// feature - часть проекта, без которой файл не генерируется (Project.enabled)
+	feature string
+}
+
+func (o output) pathFor(name string) string {
+	if name == "" {
+		return o.path
+	}
+	return strings.ReplaceAll(o.path, "{name}", strings.ToLower(name))
+}
+
+// commonOutputs генерируются один раз для всех моделей
+var commonOutputs = []output{
+	{template: "main.go.tmpl", path: "cmd/app/main.go"},
+	{template: "go.mod.tmpl", path: "go.mod"},
+	{template: "docker-compose.yml.tmpl", path: "docker-compose.yml", feature: "docker"},
+	{template: "Dockerfile.tmpl", path: "Dockerfile", feature: "docker"},
+	{template: "env.tmpl", path: ".env"},
+	{template: "repository.go.tmpl", path: "internal/repository/repository.go"},
+	{template: "interfaces.go.tmpl", path: "internal/interfaces/interfaces.go"},
+	{template: "errors.go.tmpl", path: "internal/models/errors.go"},
+	{template: "types.go.tmpl", path: "internal/models/types.go"},
+	{template: "nullable.go.tmpl", path: "internal/models/nullable.go"},
+	{template: "gitlab-ci.yml.tmpl", path: ".gitlab-ci.yml", feature: "ci:gitlab"},
+	{template: "github-ci.yml.tmpl", path: ".github/workflows/ci.yml", feature: "ci:github"},
+	{template: "grpc_test.go.tmpl", path: "internal/tests/grpc_test.go", feature: "tests"},
+}
+
+// modelOutputs генерируются для каждой модели. Файлы *_gen.go всегда
+// перезаписываются, парные им файлы без суффикса создаются один раз и
+// предназначены для ручных доработок.
+var modelOutputs = []output{
+	{template: "repository_model.go.tmpl", path: "internal/repository/{name}/repository.go"},
+	{template: "models.go.tmpl", path: "internal/models/{name}.go"},
+	{template: "service.go.tmpl", path: "internal/service/{name}/service_gen.go"},
+	{template: "service_custom.go.tmpl", path: "internal/service/{name}/service.go", mode: modeCreateOnly},
+	{template: "grpc.go.tmpl", path: "internal/grpc/{name}/server_gen.go"},
+	{template: "grpc_custom.go.tmpl", path: "internal/grpc/{name}/server.go", mode: modeCreateOnly},
+}
+
+// serviceOutputs генерируются для каждого самостоятельного сервиса из proto.
+// Парные файлы для доработок те же, что и у моделей.
+var serviceOutputs = []output{
+	{template: "rpc_service.go.tmpl", path: "internal/service/{name}/service_gen.go"},
+	{template: "service_custom.go.tmpl", path: "internal/service/{name}/service.go", mode: modeCreateOnly},
+	{template: "rpc_grpc.go.tmpl", path: "internal/grpc/{name}/server_gen.go"},
+	{template: "grpc_custom.go.tmpl", path: "internal/grpc/{name}/server.go", mode: modeCreateOnly},
+}
+
+// writeFile записывает сгенерированное содержимое с учётом режима файла
+// и регистрирует файл в манифесте текущего запуска. name - имя модели или
+// сервиса, для общих файлов пустое.
+func (g *Generator) writeFile(dst outfs.FS, out output, name string, content []byte) error {
+	relPath := out.pathFor(name)
+	if path.Ext(relPath) == ".go" {
+		content = g.formatSource(relPath, content)
+	}
+
+	entry := ManifestEntry{
+		Path:     relPath,
+		Template: out.template,
+		Mode:     out.mode.String(),
+		Model:    name,
+	}
+
+	existing, err := fs.ReadFile(dst, relPath)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", relPath, err)
+	}
+
+	if out.mode == modeCreateOnly && exists && g.upgrade == nil {
+		// Файл уже принадлежит пользователю, сохраняем прежнюю контрольную сумму
+		entry.Checksum = checksum(existing)
+		if prev, ok := g.previous.Lookup(entry.Path); ok {
+			entry.Checksum = prev.Checksum
+		}
+		g.manifest.Files = append(g.manifest.Files, entry)
+		return nil
+	}
+
+	if out.mode == modeOverwrite && exists {
+		merged, orphaned, err := mergeRegions(content, existing)
+		if err != nil {
+			return fmt.Errorf("failed to preserve custom regions in %s: %w", relPath, err)
+		}
+		if len(orphaned) > 0 {
+			backup := path.Join(stateDir, "backup", relPath)
+			if err := dst.WriteFile(backup, existing); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", relPath, err)
+			}
+			g.logger.Warn("custom regions no longer exist, previous version saved",
+				"path", relPath, "regions", orphaned, "backup", backup)
+		}
+		content = merged
+	}
+
+	generated := content
+	if g.upgrade != nil {
+		// При обновлении новая версия сливается с пользовательской
+		merged, err := g.upgradeFile(dst, relPath, existing, exists, generated)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade %s: %w", relPath, err)
+		}
+		if merged == nil {
+			merged = existing
+		}
+		content = merged
+	}
+
+	if err := saveBase(dst, relPath, generated); err != nil {
+		return fmt.Errorf("failed to save base version of %s: %w", relPath, err)
+	}
+
+	entry.Checksum = checksum(content)
+	g.manifest.Files = append(g.manifest.Files, entry)
+
+	if exists && bytes.Equal(existing, content) {
+		return nil
+	}
+	if err := dst.WriteFile(relPath, content); err != nil {
+		return err
+	}
+	kind := ChangeCreated
+	if exists {
+		kind = ChangeUpdated
+	}
+	g.logger.Debug("wrote file", "path", entry.Path, "change", kind)
+	g.changes = append(g.changes, Change{Path: entry.Path, Kind: kind})
+	return nil
+}
+
+// ChangeKind - что произошло с файлом за запуск генератора
+type ChangeKind string
+
+const (
+	ChangeCreated ChangeKind = "created"
+	ChangeUpdated ChangeKind = "updated"
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// Change - файл, который запуск генератора создал, изменил или удалил
+type Change struct {
+	// Path - путь относительно output директории через /
+	Path string
+	Kind ChangeKind
+}
+
+// Changes возвращает файлы, изменённые последним запуском. Файлы, чьё
+// содержимое не изменилось, не перезаписываются и сюда не попадают.
+func (g *Generator) Changes() []Change {
+	return g.changes
+}
+
+// removeStaleFiles удаляет файлы, которые генератор создавал раньше, но
+// больше не создаёт. Файлы, изменённые вручную, остаются на месте.
+func (g *Generator) removeStaleFiles(dst outfs.FS) error {
+	for _, prev := range g.previous.Files {
+		if _, ok := g.manifest.Lookup(prev.Path); ok || !prev.Owned() {
+			continue
+		}
+
+		content, err := fs.ReadFile(dst, prev.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", prev.Path, err)
+		}
+
+		if checksum(content) != prev.Checksum {
+			g.logger.Warn("file is no longer generated but was modified, leaving it in place", "path", prev.Path)
+			continue
+		}
+		if err := dst.Remove(prev.Path); err != nil {
+			return fmt.Errorf("failed to remove stale file %s: %w", prev.Path, err)
+		}
+		g.logger.Debug("removed stale file", "path", prev.Path)
+		g.changes = append(g.changes, Change{Path: prev.Path, Kind: ChangeRemoved})
+	}
+	return nil
+}
+
+// formatSource форматирует Go код как gofmt. Код с синтаксической ошибкой
+// записывается как есть, чтобы ошибку было видно в самом файле.
+func (g *Generator) formatSource(relPath string, content []byte) []byte {
+	formatted, err := format.Source(content)
+	if err != nil {
+		g.logger.Warn("failed to format generated file", "path", relPath, "error", err)
+		return content
+	}
+	return formatted
+}
@@ -1,120 +1,312 @@
 package generator
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
+	"log/slog"
+	"path/filepath"
 	"strings"
 
 	"github.com/iancoleman/strcase"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/types/descriptorpb"
+
+	"generator/internal/inflect"
+	"generator/internal/modpath"
+	"generator/internal/protoload"
 )
 
-type Parser struct{}
+type Parser struct {
+	// legacyEntities включает прежнее правило: таблицей становится каждое
+	// сообщение, кроме *Request и *Response
+	legacyEntities bool
+	// protoImport - Go пакет сгенерированных proto сообщений
+	protoImport string
+	// importPaths - директории для импортов proto файлов
+	importPaths []string
+	// overrides - параметры сообщений из конфигурации проекта
+	overrides map[string]protoload.Override
 
-func NewParser() *Parser {
-	return &Parser{}
-}
+	// valueTypes - уже разобранные типы-значения по полному имени сообщения
+	valueTypes map[protoreflect.FullName]*ValueType
 
-func (p *Parser) Parse(protoPath string) ([]*Model, error) {
-	if protoPath == "" {
-		return nil, fmt.Errorf("protoPath is empty")
-	}
+	// files - разобранные proto файлы, для снимка схемы appgen breaking
+	files []parsedFile
 
-	fmt.Printf("Parsing proto file: %s\n", protoPath)
-	// Компилируем proto файл
-	cmd := exec.Command("protoc",
-		"--descriptor_set_out=/tmp/proto.pb",
-		"--include_imports",
-		protoPath,
-	)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return nil, fmt.Errorf("failed to compile proto file: %w, output: %s", err, out)
-	}
+	// lint - ошибки первичного ключа не прерывают разбор, а остаются
+	// в модели для appgen lint
+	lint bool
 
-	// Читаем дескриптор
-	descBytes, err := os.ReadFile("/tmp/proto.pb")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read descriptor: %w", err)
+	logger *slog.Logger
+}
+
+// parsedFile - proto файл и путь, по которому его передали парсеру
+type parsedFile struct {
+	path string
+	desc protoreflect.FileDescriptor
+}
+
+func NewParser() *Parser {
+	return &Parser{
+		protoImport: modpath.ProtoImport(modpath.Default),
+		valueTypes:  make(map[protoreflect.FullName]*ValueType),
+		logger:      slog.Default(),
 	}
+}
 
-	var fdSet descriptorpb.FileDescriptorSet
-	if err := proto.Unmarshal(descBytes, &fdSet); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal descriptor: %w", err)
+// Parse разбирает proto файл и возвращает модели и объявленные в нём сервисы
+func (p *Parser) Parse(protoPath string) ([]*Model, []*Service, error) {
+	if protoPath == "" {
+		return nil, nil, fmt.Errorf("protoPath is empty")
 	}
 
-	fd, err := protodesc.NewFiles(&fdSet)
+	p.logger.Debug("parsing proto file", "path", protoPath)
+	// Компилируем proto файл
+	relPath, importPaths := p.resolve(protoPath)
+	set, err := protoload.Load(context.Background(), []string{relPath}, importPaths)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create file descriptor: %w", err)
+		return nil, nil, fmt.Errorf("failed to compile proto file: %w", err)
 	}
+	set.SetOverrides(p.overrides)
+	set.SetLegacyEntities(p.legacyEntities)
 
-	desc, err := fd.FindFileByPath(protoPath)
+	desc, err := set.File(relPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find proto file: %w", err)
+		return nil, nil, fmt.Errorf("failed to find proto file: %w", err)
 	}
+	p.files = append(p.files, parsedFile{path: protoPath, desc: desc})
 
 	var models []*Model
 
 	// Parse messages
-	messages := desc.Messages()
-	for i := 0; i < messages.Len(); i++ {
-		message := messages.Get(i)
+	for _, message := range p.entities(set, desc) {
 		name := string(message.Name())
+		p.logger.Debug("parsing message", "message", name)
 
-		fmt.Printf("Found message: %s\n", name)
-
-		// Пропускаем сообщения запросов и ответов
-		if strings.HasSuffix(name, "Request") || strings.HasSuffix(name, "Response") {
-			fmt.Printf("Skipping message %s (request/response)\n", name)
-			continue
+		opts := set.MessageOptions(message)
+		api, err := set.API(message)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		fmt.Printf("Parsing message: %s\n", name)
-
 		model := &Model{
-			Name:   name,
-			Fields: make([]*Field, 0, message.Fields().Len()),
+			Name:     name,
+			Table:    opts.Table,
+			Resource: opts.Resource,
+			API:      api,
+			Fields:   make([]*Field, 0, message.Fields().Len()),
+			file:     protoPath,
+			desc:     message,
+		}
+		if model.Table == "" {
+			model.Table = inflect.TableName(name)
+		}
+		if model.Resource == "" {
+			model.Resource = inflect.ResourceName(name)
 		}
 
-		fields := message.Fields()
-		for j := 0; j < fields.Len(); j++ {
-			field := fields.Get(j)
-			f := p.parseFieldFromDescriptor(field)
-			model.Fields = append(model.Fields, f)
+		model.Fields, err = p.parseFields(set, message)
+		if err != nil {
+			return nil, nil, err
+		}
+		model.PK, err = p.parsePrimaryKey(set, message, model.Fields)
+		if err == nil && model.PK.Strategy == string(protoload.KeyDBDefault) && api.Has(protoload.MethodUpsert) {
+			// Upsert пишет ключ из запроса, а BIGSERIAL о таких ключах не
+			// знает: последовательность отстаёт, и следующий Create упадёт
+			err = fmt.Errorf("%s: (appgen.api) UPSERT requires a client-supplied key, but the key is generated by the database; use the UUID_V7, ULID or NATURAL strategy", message.FullName())
+		}
+		if err != nil {
+			if !p.lint {
+				return nil, nil, err
+			}
+			model.keyErr = err
 		}
 
 		models = append(models, model)
 	}
 
-	return models, nil
+	// Parse services
+	var services []*Service
+	serviceDescs := desc.Services()
+	for i := 0; i < serviceDescs.Len(); i++ {
+		p.logger.Debug("found service", "service", serviceDescs.Get(i).Name())
+		service, err := p.parseService(serviceDescs.Get(i), set.HasHTTPRule)
+		if err != nil {
+			return nil, nil, err
+		}
+		services = append(services, service)
+	}
+
+	return models, services, nil
 }
 
-func (p *Parser) parseFieldFromDescriptor(field protoreflect.FieldDescriptor) *Field {
-	name := string(field.Name())
-	dbName := strcase.ToSnake(name)
-	sqlType := p.getSqlTypeFromKind(field.Kind(), name)
+// resolve возвращает путь файла относительно import path, в которой он
+// лежит, и список import paths. Файл вне import paths компилируется по
+// своему пути, как раньше.
+func (p *Parser) resolve(protoPath string) (string, []string) {
+	for _, dir := range p.importPaths {
+		rel, err := filepath.Rel(dir, protoPath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel), p.importPaths
+		}
+	}
+	return protoPath, nil
+}
+
+// parsePrimaryKey отмечает поля ключа и задаёт типы их колонок по стратегии
+func (p *Parser) parsePrimaryKey(set *protoload.Set, message protoreflect.MessageDescriptor, fields []*Field) (*PrimaryKey, error) {
+	key, err := set.PrimaryKey(message)
+	if err != nil {
+		return nil, err
+	}
+
+	pk := &PrimaryKey{Strategy: string(key.Strategy)}
+	for _, fd := range key.Fields {
+		var field *Field
+		for _, f := range fields {
+			if f.Name == string(fd.Name()) {
+				field = f
+			}
+		}
+
+		field.Key = true
+		switch key.Strategy {
+		case protoload.KeyDBDefault:
+			field.DBGenerated = true
+			field.SqlType = "BIGSERIAL"
+			if fd.Kind() == protoreflect.StringKind {
+				field.SqlType = "UUID"
+				field.SqlDefault = "gen_random_uuid()"
+			}
+		case protoload.KeyUUIDv7:
+			field.SqlType = "UUID"
+		case protoload.KeyULID:
+			field.SqlType = "CHAR(26)"
+		}
+		pk.Fields = append(pk.Fields, field)
+	}
+
+	return pk, nil
+}
 
-	return &Field{
+// entities возвращает сообщения файла, которые становятся таблицами
+func (p *Parser) entities(set *protoload.Set, desc protoreflect.FileDescriptor) []protoreflect.MessageDescriptor {
+	entities := set.Entities(desc)
+	if len(entities) == 0 && !p.legacyEntities {
+		p.logger.Warn("no messages marked with (appgen.entity), the file adds no tables; set legacy_entities to use every message",
+			"file", desc.Path())
+	}
+	for i := 0; i < desc.Messages().Len(); i++ {
+		if md := desc.Messages().Get(i); !set.IsEntity(md) {
+			p.logger.Debug("skipping message, it is not an entity", "message", md.Name())
+		}
+	}
+	return entities
+}
+
+func (p *Parser) parseFields(set *protoload.Set, message protoreflect.MessageDescriptor) ([]*Field, error) {
+	fields := message.Fields()
+	result := make([]*Field, 0, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		f, err := p.parseFieldFromDescriptor(set, fields.Get(i))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+func (p *Parser) parseFieldFromDescriptor(set *protoload.Set, field protoreflect.FieldDescriptor) (*Field, error) {
+	name := string(field.Name())
+	opts := set.FieldOptions(field)
+	f := &Field{
 		Name:     name,
-		DbName:   dbName,
-		SqlType:  sqlType,
-		Type:     getGoType(field),
+		DbName:   strcase.ToSnake(name),
 		JsonName: field.JSONName(),
+		Repeated: field.Cardinality() == protoreflect.Repeated,
+		Required: opts.Required,
+		RefName:  opts.Ref,
 		Last:     false, // будет установлено позже если нужно
+		desc:     field,
+	}
+
+	if field.IsMap() {
+		return nil, fmt.Errorf("field %s: map fields are not supported", field.FullName())
+	}
+
+	if field.Kind() != protoreflect.MessageKind {
+		f.SqlType = p.getSqlTypeFromKind(field.Kind(), name)
+		f.Type = getGoType(field)
+		if ed := field.Enum(); ed != nil {
+			f.Enum = strings.ReplaceAll(strings.TrimPrefix(string(ed.FullName()), string(ed.ParentFile().Package())+"."), ".", "_")
+		}
+		return f, nil
+	}
+
+	md := field.Message()
+	switch {
+	case md.FullName() == timestampName:
+		if f.Repeated {
+			return nil, fmt.Errorf("field %s: repeated timestamps are not supported", field.FullName())
+		}
+		f.Timestamp = true
+		f.Type = "time.Time"
+		f.SqlType = "TIMESTAMPTZ"
+	case set.IsEntity(md):
+		return nil, fmt.Errorf("field %s refers to entity %s, reference it by id (%s_id) instead",
+			field.FullName(), md.Name(), strcase.ToSnake(string(md.Name())))
+	default:
+		vt, err := p.parseValueType(set, md)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.FullName(), err)
+		}
+		f.Value = vt
+		f.SqlType = "JSONB"
+		f.Type = "*" + vt.Name
+		if f.Repeated {
+			f.Type = vt.Name + "List"
+		}
 	}
+
+	return f, nil
+}
+
+// timestampName - тип времени, который в моделях становится time.Time
+const timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+
+// parseValueType разбирает сообщение, которое хранится в JSONB колонке
+func (p *Parser) parseValueType(set *protoload.Set, md protoreflect.MessageDescriptor) (*ValueType, error) {
+	if vt, ok := p.valueTypes[md.FullName()]; ok {
+		return vt, nil
+	}
+	if md.ParentFile().Package() == "google.protobuf" {
+		return nil, fmt.Errorf("message type %s is not supported", md.FullName())
+	}
+
+	protoName := strings.ReplaceAll(strings.TrimPrefix(string(md.FullName()), string(md.ParentFile().Package())+"."), ".", "_")
+	vt := &ValueType{
+		Name:      strcase.ToCamel(protoName),
+		ProtoName: protoName,
+	}
+	// Регистрируем тип до разбора полей, чтобы поддержать рекурсивные типы
+	p.valueTypes[md.FullName()] = vt
+
+	fields, err := p.parseFields(set, md)
+	if err != nil {
+		delete(p.valueTypes, md.FullName())
+		return nil, err
+	}
+	vt.Fields = fields
+
+	return vt, nil
 }
 
 func (p *Parser) getSqlTypeFromKind(kind protoreflect.Kind, fieldName string) string {
 	switch kind {
-	case protoreflect.Int32Kind:
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind, protoreflect.EnumKind:
 		return "INTEGER"
-	case protoreflect.Int64Kind:
-		if strings.HasSuffix(fieldName, "_id") {
-			return "BIGINT"
-		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
 		return "BIGINT"
 	case protoreflect.BoolKind:
 		return "BOOLEAN"
@@ -134,16 +326,29 @@ func (p *Parser) getSqlTypeFromKind(kind protoreflect.Kind, fieldName string) st
 	}
 }
 
+// getGoType возвращает Go тип поля в моделях. Он совпадает с типом поля
+// в коде protoc-gen-go, чтобы преобразования моделей присваивали значения
+// напрямую; перечисления хранятся как int32.
 func getGoType(field protoreflect.FieldDescriptor) string {
 	switch field.Kind() {
-	case protoreflect.Int64Kind:
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
 		return "int64"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "uint64"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind, protoreflect.EnumKind:
+		return "int32"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "uint32"
 	case protoreflect.StringKind:
 		return "string"
 	case protoreflect.BoolKind:
 		return "bool"
 	case protoreflect.DoubleKind:
 		return "float64"
+	case protoreflect.FloatKind:
+		return "float32"
+	case protoreflect.BytesKind:
+		return "[]byte"
 	case protoreflect.MessageKind:
 		return "*" + string(field.Message().Name())
 	default:
@@ -0,0 +1,239 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+
+	"generator/internal/outfs"
+)
+
+// pluginTemplatePrefix отличает в манифесте файлы плагинов от файлов
+// шаблонов: plugin:<имя плагина>
+const pluginTemplatePrefix = "plugin:"
+
+// Plugin добавляет в проект файлы, которых нет во встроенных шаблонах.
+// Плагины запускаются при каждой генерации со всеми моделями, а их файлы
+// проходят тот же путь, что и файлы шаблонов: защищённые области,
+// манифест, удаление устаревших файлов и пробный запуск.
+type Plugin interface {
+	// Name - имя плагина в манифесте и сообщениях об ошибках
+	Name() string
+	Generate(ctx context.Context, req *PluginRequest) ([]PluginFile, error)
+}
+
+// PluginRequest - данные, которые получает плагин
+type PluginRequest struct {
+	// Module - путь Go модуля генерируемого сервиса
+	Module  string
+	Project Project
+	// Models - все модели в порядке создания таблиц
+	Models []*Model
+}
+
+// PluginFile - файл, который вернул плагин
+type PluginFile struct {
+	// Path - путь относительно output директории через /
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// Model - модель, к которой относится файл, для общих файлов пусто
+	Model string `json:"model,omitempty"`
+	// CreateOnly - файл создаётся один раз и дальше принадлежит пользователю
+	CreateOnly bool `json:"create_only,omitempty"`
+}
+
+// generatePlugins запускает плагины и записывает их файлы
+func (g *Generator) generatePlugins(ctx context.Context, models []*Model, dst outfs.FS) error {
+	req := &PluginRequest{Module: g.module, Project: g.project, Models: models}
+	for _, p := range g.plugins {
+		files, err := p.Generate(ctx, req)
+		if err != nil {
+			return fmt.Errorf("plugin %s failed: %w", p.Name(), err)
+		}
+		g.logger.Debug("plugin generated files", "plugin", p.Name(), "files", len(files))
+
+		for _, f := range files {
+			if !fs.ValidPath(f.Path) || f.Path == "." || strings.HasPrefix(f.Path, stateDir+"/") {
+				return fmt.Errorf("plugin %s returned invalid path %q", p.Name(), f.Path)
+			}
+			if prev, ok := g.manifest.Lookup(f.Path); ok {
+				return fmt.Errorf("plugin %s: %s is already generated by %s", p.Name(), f.Path, prev.Template)
+			}
+
+			out := output{template: pluginTemplatePrefix + p.Name(), path: f.Path}
+			if f.CreateOnly {
+				out.mode = modeCreateOnly
+			}
+			if err := g.writeFile(dst, out, f.Model, []byte(f.Content)); err != nil {
+				return fmt.Errorf("plugin %s: failed to write %s: %w", p.Name(), f.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExecPlugin - внешний плагин: исполняемый файл, который, как плагины
+// protoc, получает запрос в JSON на stdin и печатает ответ в JSON на stdout.
+// Запрос:
+//
+//	{"plugin": "kafka", "module": "...", "project": {...},
+//	 "options": {...}, "models": [...]}
+//
+// Ответ:
+//
+//	{"files": [{"path": "...", "content": "...", "model": "...", "create_only": false}],
+//	 "error": ""}
+//
+// Непустое поле error или ненулевой код выхода прерывают генерацию.
+type ExecPlugin struct {
+	PluginName string
+	// Command - исполняемый файл и его аргументы
+	Command []string
+	// Dir - рабочая директория плагина, по умолчанию текущая
+	Dir string
+	// Options - параметры плагина из настроек проекта
+	Options map[string]string
+}
+
+func (p *ExecPlugin) Name() string {
+	return p.PluginName
+}
+
+func (p *ExecPlugin) Generate(ctx context.Context, req *PluginRequest) ([]PluginFile, error) {
+	if len(p.Command) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+
+	input := execPluginRequest{
+		Plugin:  p.PluginName,
+		Module:  req.Module,
+		Project: req.Project,
+		Options: p.Options,
+		Models:  make([]pluginModel, len(req.Models)),
+	}
+	for i, m := range req.Models {
+		input.Models[i] = newPluginModel(m)
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Dir = p.Dir
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	var resp execPluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Files, nil
+}
+
+type execPluginRequest struct {
+	Plugin  string            `json:"plugin"`
+	Module  string            `json:"module"`
+	Project Project           `json:"project"`
+	Options map[string]string `json:"options,omitempty"`
+	Models  []pluginModel     `json:"models"`
+}
+
+type execPluginResponse struct {
+	Files []PluginFile `json:"files"`
+	Error string       `json:"error,omitempty"`
+}
+
+// pluginModel - модель в запросе внешнего плагина. Ссылки на другие модели
+// передаются именами, поэтому циклы моделей не мешают кодированию.
+type pluginModel struct {
+	Name     string        `json:"name"`
+	Table    string        `json:"table"`
+	Resource string        `json:"resource"`
+	Key      []string      `json:"key"`
+	Strategy string        `json:"key_strategy"`
+	Methods  []string      `json:"methods"`
+	RPCs     []string      `json:"rpcs,omitempty"`
+	Fields   []pluginField `json:"fields"`
+}
+
+type pluginField struct {
+	Name     string `json:"name"`
+	JSONName string `json:"json_name"`
+	Column   string `json:"column"`
+	GoType   string `json:"go_type"`
+	SQLType  string `json:"sql_type"`
+	Repeated bool   `json:"repeated,omitempty"`
+	Required bool   `json:"required,omitempty"`
+	Key      bool   `json:"key,omitempty"`
+	// Value - тип-значение поля, хранится в JSONB колонке
+	Value string `json:"value,omitempty"`
+	// Ref - модель, на которую ссылается поле
+	Ref      string `json:"ref,omitempty"`
+	Deferred bool   `json:"deferred,omitempty"`
+}
+
+func newPluginModel(m *Model) pluginModel {
+	pm := pluginModel{
+		Name:     m.Name,
+		Table:    m.Table,
+		Resource: m.Resource,
+		Key:      []string{},
+		Strategy: m.PK.Strategy,
+		Methods:  []string{},
+		Fields:   []pluginField{},
+	}
+	for _, f := range m.PK.Fields {
+		pm.Key = append(pm.Key, f.Name)
+	}
+	for _, method := range m.API.Methods {
+		pm.Methods = append(pm.Methods, string(method))
+	}
+	for _, method := range m.API.Custom {
+		pm.Methods = append(pm.Methods, method.Name)
+	}
+	for _, rpc := range m.RPCs {
+		pm.RPCs = append(pm.RPCs, rpc.Name)
+	}
+	for _, f := range m.Fields {
+		pf := pluginField{
+			Name:     f.Name,
+			JSONName: f.JsonName,
+			Column:   strings.ToLower(f.DbName),
+			GoType:   f.Type,
+			SQLType:  f.SqlType,
+			Repeated: f.Repeated,
+			Required: f.Required,
+			Key:      f.Key,
+			Deferred: f.Deferred,
+		}
+		if f.Value != nil {
+			pf.Value = f.Value.Name
+		}
+		if f.Ref != nil {
+			pf.Ref = f.Ref.Name
+		}
+		pm.Fields = append(pm.Fields, pf)
+	}
+	return pm
+}
+
+// isPluginFile сообщает, создан ли файл манифеста плагином
+func isPluginFile(e ManifestEntry) bool {
+	return strings.HasPrefix(e.Template, pluginTemplatePrefix)
+}
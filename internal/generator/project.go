@@ -0,0 +1,71 @@
+package generator
+
+// Project - параметры генерируемого проекта, которые не выводятся из proto:
+// версии, порты и набор включённых частей. Шаблоны получают их через
+// функцию project.
+type Project struct {
+	// GoVersion - версия Go в go.mod, Dockerfile и CI
+	GoVersion string `json:"go_version"`
+	// HTTPPort, GRPCPort - порты сервиса по умолчанию
+	HTTPPort int      `json:"http_port"`
+	GRPCPort int      `json:"grpc_port"`
+	Database Database `json:"database"`
+	Features Features `json:"features"`
+}
+
+// Database - база данных сервиса
+type Database struct {
+	// Dialect - диалект SQL, пока поддерживается только postgres
+	Dialect string `json:"dialect"`
+	// Version - мажорная версия образа базы данных
+	Version string `json:"version"`
+}
+
+// Features - необязательные части проекта
+type Features struct {
+	// Gateway - HTTP gateway поверх gRPC
+	Gateway bool `json:"gateway"`
+	// Tests - интеграционные тесты gRPC API
+	Tests bool `json:"tests"`
+	// Docker - Dockerfile и docker-compose.yml
+	Docker bool `json:"docker"`
+	// CI - система CI, для которой генерируется конфигурация: gitlab, github или none
+	CI string `json:"ci"`
+}
+
+// DefaultProject возвращает параметры проекта по умолчанию
+func DefaultProject() Project {
+	return Project{
+		GoVersion: "1.23",
+		HTTPPort:  8080,
+		GRPCPort:  50051,
+		Database: Database{
+			Dialect: "postgres",
+			Version: "15",
+		},
+		Features: Features{
+			Gateway: true,
+			Tests:   true,
+			Docker:  true,
+			CI:      "gitlab",
+		},
+	}
+}
+
+// enabled сообщает, нужно ли генерировать файлы части проекта.
+// Пустое имя означает обязательный файл.
+func (p Project) enabled(feature string) bool {
+	switch feature {
+	case "":
+		return true
+	case "gateway":
+		return p.Features.Gateway
+	case "tests":
+		return p.Features.Tests
+	case "docker":
+		return p.Features.Docker
+	default:
+		// ci:<система>
+		return feature == "ci:"+p.Features.CI
+	}
+}
@@ -0,0 +1,164 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Маркеры защищённых областей. Всё, что находится между ними, переносится
+// из существующего файла в заново сгенерированный. Маркер может стоять в
+// комментарии любого вида (//, #, --), имя после "custom" необязательно.
+const (
+	regionBeginMarker = "appgen:begin custom"
+	regionEndMarker   = "appgen:end"
+)
+
+// region описывает одну защищённую область файла
+type region struct {
+	key  string
+	body []string
+}
+
+// parseRegions находит защищённые области в содержимом файла
+func parseRegions(content []byte) ([]region, error) {
+	var regions []region
+	var current *region
+	seen := make(map[string]int)
+
+	for i, line := range splitContentLines(content) {
+		if name, ok := regionBegin(line); ok {
+			if current != nil {
+				return nil, fmt.Errorf("line %d: nested %q marker", i+1, regionBeginMarker)
+			}
+			key := name
+			if n := seen[name]; n > 0 {
+				key = fmt.Sprintf("%s#%d", name, n)
+			}
+			seen[name]++
+			current = &region{key: key}
+			continue
+		}
+		if isRegionEnd(line) {
+			if current == nil {
+				return nil, fmt.Errorf("line %d: %q without matching %q", i+1, regionEndMarker, regionBeginMarker)
+			}
+			regions = append(regions, *current)
+			current = nil
+			continue
+		}
+		if current != nil {
+			current.body = append(current.body, line)
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("region %q is not closed with %q", current.key, regionEndMarker)
+	}
+
+	return regions, nil
+}
+
+// mergeRegions переносит содержимое защищённых областей из old в generated.
+// Возвращает итоговое содержимое и ключи областей, которым не нашлось места
+// в новой версии файла.
+func mergeRegions(generated, old []byte) ([]byte, []string, error) {
+	oldRegions, err := parseRegions(old)
+	if err != nil {
+		return nil, nil, fmt.Errorf("existing file: %w", err)
+	}
+	if len(oldRegions) == 0 {
+		return generated, nil, nil
+	}
+
+	// Проверяем, что в сгенерированном файле маркеры расставлены корректно
+	if _, err := parseRegions(generated); err != nil {
+		return nil, nil, fmt.Errorf("generated file: %w", err)
+	}
+
+	saved := make(map[string][]string, len(oldRegions))
+	for _, r := range oldRegions {
+		saved[r.key] = r.body
+	}
+
+	var out []string
+	used := make(map[string]bool)
+	seen := make(map[string]int)
+	skipping := false
+
+	for _, line := range splitContentLines(generated) {
+		if name, ok := regionBegin(line); ok {
+			key := name
+			if n := seen[name]; n > 0 {
+				key = fmt.Sprintf("%s#%d", name, n)
+			}
+			seen[name]++
+
+			out = append(out, line)
+			if body, ok := saved[key]; ok {
+				out = append(out, body...)
+				used[key] = true
+				skipping = true
+			}
+			continue
+		}
+		if isRegionEnd(line) {
+			skipping = false
+			out = append(out, line)
+			continue
+		}
+		if !skipping {
+			out = append(out, line)
+		}
+	}
+
+	var orphaned []string
+	for _, r := range oldRegions {
+		if !used[r.key] && !isBlankRegion(r.body) {
+			orphaned = append(orphaned, r.key)
+		}
+	}
+
+	return []byte(strings.Join(out, "\n")), orphaned, nil
+}
+
+func regionBegin(line string) (string, bool) {
+	idx := strings.Index(line, regionBeginMarker)
+	if idx < 0 || !isCommentPrefix(line[:idx]) {
+		return "", false
+	}
+	return strings.TrimSpace(line[idx+len(regionBeginMarker):]), true
+}
+
+func isRegionEnd(line string) bool {
+	idx := strings.Index(line, regionEndMarker)
+	if idx < 0 || !isCommentPrefix(line[:idx]) {
+		return false
+	}
+	return strings.TrimSpace(line[idx+len(regionEndMarker):]) == ""
+}
+
+// isCommentPrefix проверяет, что маркер стоит сразу после начала комментария
+func isCommentPrefix(prefix string) bool {
+	prefix = strings.TrimSpace(prefix)
+	for _, comment := range []string{"//", "#", "--"} {
+		if strings.TrimSpace(strings.TrimSuffix(prefix, comment)) == "" && strings.HasSuffix(prefix, comment) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlankRegion(body []string) bool {
+	for _, line := range body {
+		if strings.TrimSpace(line) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func splitContentLines(content []byte) []string {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	return strings.Split(string(content), "\n")
+}
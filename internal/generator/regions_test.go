@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRegions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []region
+		wantErr bool
+	}{
+		{
+			name:    "no regions",
+			content: "package x\n\nfunc f() {}\n",
+		},
+		{
+			name:    "named region",
+			content: "a\n// appgen:begin custom imports\n\"fmt\"\n// appgen:end\nb\n",
+			want:    []region{{key: "imports", body: []string{"\"fmt\""}}},
+		},
+		{
+			name:    "any comment style and empty name",
+			content: "# appgen:begin custom\nx: 1\n# appgen:end\n    -- appgen:begin custom sql\n    -- appgen:end\n",
+			want: []region{
+				{key: "", body: []string{"x: 1"}},
+				{key: "sql"},
+			},
+		},
+		{
+			name:    "repeated names get an index",
+			content: "// appgen:begin custom m\n1\n// appgen:end\n// appgen:begin custom m\n2\n// appgen:end\n",
+			want: []region{
+				{key: "m", body: []string{"1"}},
+				{key: "m#1", body: []string{"2"}},
+			},
+		},
+		{
+			name:    "marker inside a string is not a region",
+			content: "s := \"appgen:begin custom a\"\nt := \"appgen:end\"\n",
+		},
+		{
+			name:    "end marker with trailing text is body",
+			content: "// appgen:begin custom a\n// appgen:end of list\n// appgen:end\n",
+			want:    []region{{key: "a", body: []string{"// appgen:end of list"}}},
+		},
+		{
+			name:    "nested begin",
+			content: "// appgen:begin custom a\n// appgen:begin custom b\n// appgen:end\n",
+			wantErr: true,
+		},
+		{
+			name:    "end without begin",
+			content: "// appgen:end\n",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed region",
+			content: "// appgen:begin custom a\nx\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRegions([]byte(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRegions() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRegions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRegions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// schemaVersion - версия формата снимка схемы
+const schemaVersion = 1
+
+// Schema - снимок API и схемы базы данных сервиса: сообщения, перечисления
+// и сервисы исходных proto и таблицы моделей. appgen breaking сравнивает
+// два снимка; снимок можно сохранить в JSON и сравнивать с ним позже.
+type Schema struct {
+	Version  int             `json:"version"`
+	Messages []SchemaMessage `json:"messages"`
+	Enums    []SchemaEnum    `json:"enums"`
+	Services []SchemaService `json:"services"`
+	Tables   []SchemaTable   `json:"tables"`
+}
+
+// SchemaMessage - сообщение proto
+type SchemaMessage struct {
+	// Name - полное имя сообщения (shop.v1.Courier)
+	Name   string        `json:"name"`
+	Fields []SchemaField `json:"fields"`
+
+	file string
+}
+
+// SchemaField - поле сообщения proto
+type SchemaField struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+	// Type - вид поля (int64, string) или полное имя сообщения или перечисления
+	Type     string `json:"type"`
+	Repeated bool   `json:"repeated,omitempty"`
+	Map      bool   `json:"map,omitempty"`
+	Oneof    string `json:"oneof,omitempty"`
+
+	line, column int
+}
+
+// SchemaEnum - перечисление proto
+type SchemaEnum struct {
+	Name   string            `json:"name"`
+	Values []SchemaEnumValue `json:"values"`
+}
+
+// SchemaEnumValue - значение перечисления
+type SchemaEnumValue struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// SchemaService - сервис API: объявленный в proto или CRUD сервис модели
+type SchemaService struct {
+	// Name - полное имя сервиса (shop.v1.CourierService)
+	Name    string         `json:"name"`
+	Methods []SchemaMethod `json:"methods"`
+}
+
+// SchemaMethod - метод сервиса. У стандартных методов моделей типы
+// запроса и ответа не указаны: их выводит protogen.
+type SchemaMethod struct {
+	Name            string `json:"name"`
+	Input           string `json:"input,omitempty"`
+	Output          string `json:"output,omitempty"`
+	ClientStreaming bool   `json:"client_streaming,omitempty"`
+	ServerStreaming bool   `json:"server_streaming,omitempty"`
+}
+
+// SchemaTable - таблица модели
+type SchemaTable struct {
+	Name    string         `json:"name"`
+	Model   string         `json:"model"`
+	Columns []SchemaColumn `json:"columns"`
+}
+
+// SchemaColumn - колонка таблицы
+type SchemaColumn struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	NotNull    bool   `json:"not_null,omitempty"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+	// Default - есть ли у колонки значение по умолчанию в базе
+	Default bool `json:"default,omitempty"`
+	// References - таблица и колонки внешнего ключа: regions(id)
+	References string `json:"references,omitempty"`
+}
+
+// Schema разбирает proto файлы и возвращает снимок их API и схемы базы
+func (g *Generator) Schema(protoFiles []string) (*Schema, error) {
+	models, err := g.Models(protoFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schema{
+		Version:  schemaVersion,
+		Messages: []SchemaMessage{},
+		Enums:    []SchemaEnum{},
+		Services: []SchemaService{},
+		Tables:   []SchemaTable{},
+	}
+	seen := make(map[protoreflect.FullName]bool)
+	services := make(map[string]*SchemaService)
+	for _, parsed := range g.parser.files {
+		file := parsed.desc
+		s.addMessages(parsed.path, file.Messages(), seen)
+		s.addEnums(file.Enums(), seen)
+		for i := 0; i < file.Services().Len(); i++ {
+			sd := file.Services().Get(i)
+			// protogen переносит сервисы исходных файлов в выходной пакет
+			service := serviceFor(services, g.protoPackage+"."+string(sd.Name()))
+			for j := 0; j < sd.Methods().Len(); j++ {
+				md := sd.Methods().Get(j)
+				service.addMethod(SchemaMethod{
+					Name:            string(md.Name()),
+					Input:           string(md.Input().FullName()),
+					Output:          string(md.Output().FullName()),
+					ClientStreaming: md.IsStreamingClient(),
+					ServerStreaming: md.IsStreamingServer(),
+				})
+			}
+		}
+	}
+
+	for _, m := range models {
+		// CRUD сервис модели генерирует protogen в выходном пакете
+		service := serviceFor(services, g.protoPackage+"."+m.Name+"Service")
+		for _, method := range m.API.Methods {
+			service.addMethod(SchemaMethod{Name: string(method)})
+		}
+		for _, method := range m.API.Custom {
+			service.addMethod(SchemaMethod{Name: method.Name})
+		}
+
+		s.Tables = append(s.Tables, schemaTable(m))
+	}
+
+	for _, service := range services {
+		s.Services = append(s.Services, *service)
+	}
+	sort.Slice(s.Messages, func(i, j int) bool { return s.Messages[i].Name < s.Messages[j].Name })
+	sort.Slice(s.Enums, func(i, j int) bool { return s.Enums[i].Name < s.Enums[j].Name })
+	sort.Slice(s.Services, func(i, j int) bool { return s.Services[i].Name < s.Services[j].Name })
+	sort.Slice(s.Tables, func(i, j int) bool { return s.Tables[i].Name < s.Tables[j].Name })
+	return s, nil
+}
+
+func (s *Schema) addMessages(path string, messages protoreflect.MessageDescriptors, seen map[protoreflect.FullName]bool) {
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if seen[md.FullName()] || md.IsMapEntry() {
+			continue
+		}
+		seen[md.FullName()] = true
+
+		msg := SchemaMessage{Name: string(md.FullName()), Fields: []SchemaField{}, file: path}
+		for j := 0; j < md.Fields().Len(); j++ {
+			fd := md.Fields().Get(j)
+			field := SchemaField{
+				Name:     string(fd.Name()),
+				Number:   int(fd.Number()),
+				Type:     fieldType(fd),
+				Repeated: fd.Cardinality() == protoreflect.Repeated && !fd.IsMap(),
+				Map:      fd.IsMap(),
+			}
+			if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+				field.Oneof = string(oneof.Name())
+			}
+			loc := md.ParentFile().SourceLocations().ByDescriptor(fd)
+			field.line, field.column = loc.StartLine+1, loc.StartColumn+1
+			msg.Fields = append(msg.Fields, field)
+		}
+		s.Messages = append(s.Messages, msg)
+
+		s.addMessages(path, md.Messages(), seen)
+		s.addEnums(md.Enums(), seen)
+	}
+}
+
+func (s *Schema) addEnums(enums protoreflect.EnumDescriptors, seen map[protoreflect.FullName]bool) {
+	for i := 0; i < enums.Len(); i++ {
+		ed := enums.Get(i)
+		if seen[ed.FullName()] {
+			continue
+		}
+		seen[ed.FullName()] = true
+
+		enum := SchemaEnum{Name: string(ed.FullName()), Values: []SchemaEnumValue{}}
+		for j := 0; j < ed.Values().Len(); j++ {
+			vd := ed.Values().Get(j)
+			enum.Values = append(enum.Values, SchemaEnumValue{Name: string(vd.Name()), Number: int(vd.Number())})
+		}
+		s.Enums = append(s.Enums, enum)
+	}
+}
+
+// fieldType возвращает тип поля для сравнения снимков. У map полей тип
+// включает типы ключа и значения.
+func fieldType(fd protoreflect.FieldDescriptor) string {
+	switch {
+	case fd.IsMap():
+		return "map<" + fieldType(fd.MapKey()) + ", " + fieldType(fd.MapValue()) + ">"
+	case fd.Message() != nil:
+		return string(fd.Message().FullName())
+	case fd.Enum() != nil:
+		return string(fd.Enum().FullName())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+func serviceFor(services map[string]*SchemaService, name string) *SchemaService {
+	if services[name] == nil {
+		services[name] = &SchemaService{Name: name, Methods: []SchemaMethod{}}
+	}
+	return services[name]
+}
+
+// addMethod добавляет метод; метод из proto заменяет стандартный метод
+// модели с тем же именем
+func (s *SchemaService) addMethod(method SchemaMethod) {
+	for i, m := range s.Methods {
+		if m.Name == method.Name {
+			if method.Input != "" {
+				s.Methods[i] = method
+			}
+			return
+		}
+	}
+	s.Methods = append(s.Methods, method)
+}
+
+// schemaTable возвращает таблицу модели, как её создаёт миграция
+func schemaTable(m *Model) SchemaTable {
+	table := SchemaTable{Name: m.Table, Model: m.Name, Columns: []SchemaColumn{}}
+	for _, f := range m.Fields {
+		column := SchemaColumn{
+			Name:       strings.ToLower(f.DbName),
+			Type:       f.SqlType,
+			NotNull:    f.Key || f.Required,
+			PrimaryKey: f.Key,
+			Default:    f.DBGenerated || f.SqlDefault != "",
+		}
+		if f.Ref != nil {
+			column.References = f.Ref.Table + "(" + f.Ref.PK.Columns() + ")"
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	return table
+}
+
+// WriteJSON записывает снимок в JSON
+func (s *Schema) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadSchema читает снимок, записанный WriteJSON
+func ReadSchema(r io.Reader) (*Schema, error) {
+	var s Schema
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema snapshot: %w", err)
+	}
+	if s.Version != schemaVersion {
+		return nil, fmt.Errorf("unsupported schema snapshot version %d", s.Version)
+	}
+	return &s, nil
+}
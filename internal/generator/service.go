@@ -0,0 +1,184 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Service - сервис, объявленный в исходном proto файле. Сервис вида
+// <Model>Service дополняет CRUD сервис модели, остальные генерируются
+// как самостоятельные сервисы.
+type Service struct {
+	// Name - имя сервиса без суффикса Service (Report для ReportService)
+	Name string
+	// ProtoName - имя сервиса в proto (ReportService)
+	ProtoName string
+	RPCs      []*RPC
+	// HTTP - есть ли у методов сервиса HTTP маршруты gRPC-Gateway
+	HTTP bool
+}
+
+// RPC - пользовательский метод сервиса
+type RPC struct {
+	Name string
+	// Input, Output - типы сообщений в Go (proto.ShipOrderRequest, emptypb.Empty)
+	Input  string
+	Output string
+
+	imports []string
+}
+
+// RPCImports возвращает пакеты, нужные для типов пользовательских RPC
+func (s *Service) RPCImports() []string {
+	return rpcImports(s.RPCs)
+}
+
+// RPCImports возвращает пакеты, нужные для типов пользовательских RPC модели
+func (m *Model) RPCImports() []string {
+	return rpcImports(m.RPCs)
+}
+
+func rpcImports(rpcs []*RPC) []string {
+	seen := make(map[string]bool)
+	var imports []string
+	for _, rpc := range rpcs {
+		for _, imp := range rpc.imports {
+			if !seen[imp] {
+				seen[imp] = true
+				imports = append(imports, imp)
+			}
+		}
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// wellKnownPackages - Go пакеты стандартных типов google.protobuf по файлам
+var wellKnownPackages = map[string]string{
+	"google/protobuf/any.proto":        "google.golang.org/protobuf/types/known/anypb",
+	"google/protobuf/duration.proto":   "google.golang.org/protobuf/types/known/durationpb",
+	"google/protobuf/empty.proto":      "google.golang.org/protobuf/types/known/emptypb",
+	"google/protobuf/field_mask.proto": "google.golang.org/protobuf/types/known/fieldmaskpb",
+	"google/protobuf/struct.proto":     "google.golang.org/protobuf/types/known/structpb",
+	"google/protobuf/timestamp.proto":  "google.golang.org/protobuf/types/known/timestamppb",
+	"google/protobuf/wrappers.proto":   "google.golang.org/protobuf/types/known/wrapperspb",
+}
+
+// goMessageType возвращает тип сообщения в Go и пакет, который нужно импортировать.
+// Сообщения исходных файлов попадают в общий пакет proto выходного проекта.
+func (p *Parser) goMessageType(md protoreflect.MessageDescriptor) (string, string, error) {
+	file := md.ParentFile()
+	name := strings.TrimPrefix(string(md.FullName()), string(file.Package())+".")
+	goName := strings.ReplaceAll(name, ".", "_")
+
+	if file.Package() == "google.protobuf" {
+		pkg, ok := wellKnownPackages[file.Path()]
+		if !ok {
+			return "", "", fmt.Errorf("unsupported message type %s", md.FullName())
+		}
+		return pkg[strings.LastIndex(pkg, "/")+1:] + "." + goName, pkg, nil
+	}
+	return "proto." + goName, p.protoImport, nil
+}
+
+// parseService разбирает сервис proto файла. Стриминговые методы
+// пропускаются: их заглушки даёт встроенный Unimplemented сервер.
+func (p *Parser) parseService(sd protoreflect.ServiceDescriptor, hasHTTP func(protoreflect.MethodDescriptor) bool) (*Service, error) {
+	service := &Service{
+		Name:      strings.TrimSuffix(string(sd.Name()), "Service"),
+		ProtoName: string(sd.Name()),
+	}
+	if service.Name == "" {
+		service.Name = service.ProtoName
+	}
+
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		if hasHTTP(md) {
+			service.HTTP = true
+		}
+		if md.IsStreamingClient() || md.IsStreamingServer() {
+			p.logger.Warn("skipping streaming method, only unary RPCs are supported", "method", md.FullName())
+			continue
+		}
+
+		input, inputImport, err := p.goMessageType(md.Input())
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %w", md.FullName(), err)
+		}
+		output, outputImport, err := p.goMessageType(md.Output())
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %w", md.FullName(), err)
+		}
+
+		service.RPCs = append(service.RPCs, &RPC{
+			Name:    string(md.Name()),
+			Input:   input,
+			Output:  output,
+			imports: []string{inputImport, outputImport},
+		})
+	}
+
+	return service, nil
+}
+
+// attachServices добавляет пользовательские RPC сервисов вида <Model>Service
+// к моделям и возвращает самостоятельные сервисы
+func attachServices(models []*Model, services []*Service) ([]*Service, error) {
+	byName := make(map[string]*Model, len(models))
+	for _, m := range models {
+		byName[m.Name] = m
+	}
+
+	var standalone []*Service
+	for _, s := range services {
+		model, ok := byName[s.Name]
+		if !ok || s.ProtoName != s.Name+"Service" {
+			standalone = append(standalone, s)
+			continue
+		}
+
+		model.RPCs = nil
+		for _, rpc := range s.RPCs {
+			// Методы, которые генерируются из (appgen.api), повторно не объявляем
+			if model.hasGeneratedMethod(rpc.Name) {
+				continue
+			}
+			model.RPCs = append(model.RPCs, rpc)
+		}
+	}
+
+	// Пакеты сервисов и моделей называются по имени в нижнем регистре
+	seen := make(map[string]bool)
+	for _, m := range models {
+		seen[strings.ToLower(m.Name)] = true
+	}
+	for _, s := range standalone {
+		pkg := strings.ToLower(s.Name)
+		if seen[pkg] {
+			return nil, fmt.Errorf("service %s clashes with another service or model on package name %s", s.ProtoName, pkg)
+		}
+		seen[pkg] = true
+	}
+
+	return standalone, nil
+}
+
+// hasGeneratedMethod сообщает, генерируется ли RPC с таким именем из (appgen.api)
+func (m *Model) hasGeneratedMethod(name string) bool {
+	for _, method := range m.API.Methods {
+		if string(method) == name {
+			return true
+		}
+	}
+	for _, method := range m.API.Custom {
+		if method.Name == name {
+			return true
+		}
+	}
+	return false
+}
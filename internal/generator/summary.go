@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Summary - итог запуска генератора
+type Summary struct {
+	// Changes - созданные, изменённые и удалённые файлы
+	Changes []Change
+	// Models - модели, файлы которых сгенерированы
+	Models []string
+	// Migrations - все миграции проекта в порядке применения
+	Migrations []string
+	// Files - все файлы проекта по манифесту, включая не изменившиеся
+	Files []ManifestEntry
+}
+
+// Summary возвращает итог последнего запуска
+func (g *Generator) Summary() Summary {
+	s := Summary{
+		Changes:    g.changes,
+		Models:     append([]string{}, g.regenerated...),
+		Migrations: []string{},
+		Files:      []ManifestEntry{},
+	}
+	if g.manifest != nil {
+		s.Files = append(s.Files, g.manifest.Files...)
+		for _, e := range g.manifest.Files {
+			if strings.HasPrefix(e.Path, "migrations/") {
+				s.Migrations = append(s.Migrations, e.Path)
+			}
+		}
+	}
+	sort.Strings(s.Migrations)
+	return s
+}
+
+// Count возвращает число файлов с изменением kind
+func (s Summary) Count(kind ChangeKind) int {
+	n := 0
+	for _, c := range s.Changes {
+		if c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Paths возвращает пути файлов с изменением kind
+func (s Summary) Paths(kind ChangeKind) []string {
+	paths := []string{}
+	for _, c := range s.Changes {
+		if c.Kind == kind {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
+}
+
+// Print печатает изменённые файлы и итоговую строку. Если файлов больше
+// limit, печатается только итог; limit < 0 снимает ограничение.
+func (s Summary) Print(w io.Writer, limit int) {
+	if limit < 0 || len(s.Changes) <= limit {
+		for _, c := range s.Changes {
+			fmt.Fprintf(w, "  %-8s %s\n", c.Kind, c.Path)
+		}
+	}
+
+	models := "no models regenerated"
+	if len(s.Models) > 0 {
+		models = fmt.Sprintf("%d models regenerated (%s)", len(s.Models), strings.Join(s.Models, ", "))
+	}
+	fmt.Fprintf(w, "Summary: %d created, %d updated, %d removed; %s; %d migrations\n",
+		s.Count(ChangeCreated), s.Count(ChangeUpdated), s.Count(ChangeRemoved), models, len(s.Migrations))
+}
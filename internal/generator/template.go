@@ -1,78 +1,199 @@
 package generator
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"runtime"
-	"strings"
+	"text/template"
 
 	"github.com/iancoleman/strcase"
+
+	"generator/internal/templates"
 )
 
+// outputsFileName - файл в директории переопределения, который связывает
+// новые шаблоны с путями генерируемых файлов
+const outputsFileName = "outputs.json"
+
 func toCamelCase(s string) string {
 	return strcase.ToCamel(s)
 }
 
 type TemplateGenerator struct {
-	templatesPath string
-	templates     *template.Template
+	// overrideDir - директория с пользовательскими шаблонами, может быть пустой
+	overrideDir string
+	templates   *template.Template
+
+	// Выходные файлы, объявленные для новых пользовательских шаблонов
+	commonOutputs []output
+	modelOutputs  []output
+
+	logger *slog.Logger
+}
+
+// outputDecl - описание выходного файла в outputs.json
+type outputDecl struct {
+	Template string `json:"template"`
+	Path     string `json:"path"`
+	// Scope - "model" (файл на каждую модель) или "common" (один файл на проект)
+	Scope string `json:"scope"`
+	// Mode - "overwrite" (по умолчанию) или "create-only"
+	Mode string `json:"mode"`
 }
 
-func NewTemplateGenerator() *TemplateGenerator {
-	// Определяем путь к шаблонам
-	_, filename, _, _ := runtime.Caller(0)
-	templatesPath := filepath.Join(filepath.Dir(filename), "..", "templates")
-	log.Printf("Templates path: %s", templatesPath)
-
-	// Создаем FuncMap с пользовательскими функциями
-	funcMap := template.FuncMap{
-		"toLower":      strings.ToLower,
-		"toCamel":      strcase.ToCamel,
-		"toLowerCamel": strcase.ToLowerCamel,
-		"hasSuffix":    strings.HasSuffix,
-		"trimSuffix":   strings.TrimSuffix,
-		"idx":          func(i int) int { return i + 1 },
-	}
-
-	// Загружаем все шаблоны
-	tmpl := template.New("").Funcs(funcMap)
-	pattern := filepath.Join(templatesPath, "*.tmpl")
-	tmpl, err := tmpl.ParseGlob(pattern)
+// NewTemplateGenerator загружает встроенные шаблоны и, если указана
+// overrideDir, шаблоны из неё поверх встроенных
+func NewTemplateGenerator(overrideDir string, logger *slog.Logger) (*TemplateGenerator, error) {
+	// Загружаем встроенные шаблоны
+	tmpl, err := template.New("").Funcs(TemplateFuncs()).ParseFS(templates.FS, "*.tmpl")
 	if err != nil {
-		log.Fatalf("Failed to parse templates: %v", err)
+		return nil, fmt.Errorf("failed to parse built-in templates: %w", err)
 	}
 
-	return &TemplateGenerator{
-		templatesPath: templatesPath,
-		templates:     tmpl,
+	t := &TemplateGenerator{
+		overrideDir: overrideDir,
+		templates:   tmpl,
+		logger:      logger,
 	}
+
+	if overrideDir != "" {
+		if err := t.loadOverrides(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
 }
 
-func (t *TemplateGenerator) generateFromTemplateWithVars(templateName, outputPath string, vars map[string]interface{}, data interface{}) error {
-	// Создаем директорию для файла если её нет
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+// loadOverrides подменяет встроенные шаблоны одноимёнными из overrideDir и
+// подключает новые шаблоны согласно outputs.json
+func (t *TemplateGenerator) loadOverrides() error {
+	info, err := os.Stat(t.overrideDir)
+	if err != nil {
+		return fmt.Errorf("templates directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("templates directory %s is not a directory", t.overrideDir)
 	}
 
-	// Открываем файл для записи
-	f, err := os.Create(outputPath)
+	overrideFS := os.DirFS(t.overrideDir)
+	names, err := fs.Glob(overrideFS, "*.tmpl")
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return fmt.Errorf("failed to list templates in %s: %w", t.overrideDir, err)
 	}
-	defer f.Close()
 
+	builtin := make(map[string]bool)
+	for _, tmpl := range t.templates.Templates() {
+		builtin[tmpl.Name()] = true
+	}
+
+	if len(names) > 0 {
+		if _, err := t.templates.ParseFS(overrideFS, names...); err != nil {
+			return fmt.Errorf("failed to parse templates in %s: %w", t.overrideDir, err)
+		}
+	}
+
+	decls, err := readOutputDecls(overrideFS)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Join(t.overrideDir, outputsFileName), err)
+	}
+
+	declared := make(map[string]bool)
+	for _, decl := range decls {
+		if t.templates.Lookup(decl.Template) == nil {
+			return fmt.Errorf("%s: template %s not found", outputsFileName, decl.Template)
+		}
+		if decl.Path == "" {
+			return fmt.Errorf("%s: template %s has no path", outputsFileName, decl.Template)
+		}
+
+		out := output{template: decl.Template, path: decl.Path}
+		switch decl.Mode {
+		case "", modeOverwrite.String():
+		case modeCreateOnly.String():
+			out.mode = modeCreateOnly
+		default:
+			return fmt.Errorf("%s: template %s has unknown mode %q", outputsFileName, decl.Template, decl.Mode)
+		}
+
+		switch decl.Scope {
+		case "model":
+			t.modelOutputs = append(t.modelOutputs, out)
+		case "common":
+			t.commonOutputs = append(t.commonOutputs, out)
+		default:
+			return fmt.Errorf("%s: template %s has unknown scope %q", outputsFileName, decl.Template, decl.Scope)
+		}
+		declared[decl.Template] = true
+	}
+
+	for _, name := range names {
+		switch {
+		case builtin[name]:
+			t.logger.Info("using template override", "path", filepath.Join(t.overrideDir, name))
+		case !declared[name]:
+			t.logger.Warn("template is not declared in "+outputsFileName+" and will not be rendered", "template", name)
+		}
+	}
+
+	return nil
+}
+
+func readOutputDecls(fsys fs.FS) ([]outputDecl, error) {
+	data, err := fs.ReadFile(fsys, outputsFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []outputDecl
+	if err := json.Unmarshal(data, &decls); err != nil {
+		return nil, fmt.Errorf("failed to parse output declarations: %w", err)
+	}
+	return decls, nil
+}
+
+// setServices делает самостоятельные сервисы текущего запуска доступными
+// шаблонам через функцию services
+func (t *TemplateGenerator) setServices(services []*Service) {
+	t.templates.Funcs(template.FuncMap{
+		"services": func() []*Service { return services },
+	})
+}
+
+// setModule задаёт путь Go модуля, который шаблоны получают через функцию module
+func (t *TemplateGenerator) setModule(module string) {
+	t.templates.Funcs(template.FuncMap{
+		"module": func() string { return module },
+	})
+}
+
+// setProject задаёт параметры проекта, которые шаблоны получают через функцию project
+func (t *TemplateGenerator) setProject(project Project) {
+	t.templates.Funcs(template.FuncMap{
+		"project": func() Project { return project },
+	})
+}
+
+// render выполняет шаблон и возвращает результат
+func (t *TemplateGenerator) render(templateName string, data interface{}) ([]byte, error) {
 	// Получаем шаблон и выполняем его
 	tmpl := t.templates.Lookup(templateName)
 	if tmpl == nil {
-		return fmt.Errorf("template %s not found", templateName)
+		return nil, fmt.Errorf("template %s not found", templateName)
 	}
 
-	if err := tmpl.Execute(f, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	return nil
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,166 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+
+	"generator/internal/outfs"
+)
+
+// Последняя сгенерированная версия каждого файла хранится в .appgen/base,
+// она служит общим предком при трёхстороннем слиянии
+const (
+	baseDir               = "base"
+	upgradeReportFileName = "upgrade-report.txt"
+)
+
+// UpgradeStatus описывает, что произошло с файлом при обновлении
+type UpgradeStatus string
+
+const (
+	UpgradeUnchanged UpgradeStatus = "unchanged"
+	UpgradeCreated   UpgradeStatus = "created"
+	UpgradeUpdated   UpgradeStatus = "updated"
+	UpgradeKept      UpgradeStatus = "kept"
+	UpgradeMerged    UpgradeStatus = "merged"
+	UpgradeConflict  UpgradeStatus = "conflict"
+	UpgradeNoBase    UpgradeStatus = "no-base"
+)
+
+// UpgradeFile - результат обновления одного файла
+type UpgradeFile struct {
+	Path      string
+	Status    UpgradeStatus
+	Conflicts int
+}
+
+// UpgradeReport собирает результаты команды upgrade
+type UpgradeReport struct {
+	Files []UpgradeFile
+}
+
+// Conflicts возвращает файлы, в которых остались маркеры конфликтов
+func (r *UpgradeReport) Conflicts() []UpgradeFile {
+	var files []UpgradeFile
+	for _, f := range r.Files {
+		if f.Status == UpgradeConflict {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Print выводит сводку по обновлению
+func (r *UpgradeReport) Print(w io.Writer) {
+	counts := make(map[UpgradeStatus]int)
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Path < r.Files[j].Path })
+
+	for _, f := range r.Files {
+		counts[f.Status]++
+		switch f.Status {
+		case UpgradeUnchanged:
+			continue
+		case UpgradeConflict:
+			fmt.Fprintf(w, "  %-9s %s (%d conflicting hunks)\n", f.Status, f.Path, f.Conflicts)
+		case UpgradeNoBase:
+			fmt.Fprintf(w, "  %-9s %s (new version saved to %s)\n", f.Status, f.Path,
+				path.Join(stateDir, "pending", f.Path))
+		default:
+			fmt.Fprintf(w, "  %-9s %s\n", f.Status, f.Path)
+		}
+	}
+
+	fmt.Fprintf(w, "Upgrade summary: %d created, %d updated, %d merged, %d kept, %d conflicts, %d without base, %d unchanged\n",
+		counts[UpgradeCreated], counts[UpgradeUpdated], counts[UpgradeMerged], counts[UpgradeKept],
+		counts[UpgradeConflict], counts[UpgradeNoBase], counts[UpgradeUnchanged])
+}
+
+// UpgradeFromProtoFiles перегенерирует проект новыми шаблонами и сливает
+// изменения с отредактированными пользователем файлами
+func (g *Generator) UpgradeFromProtoFiles(protoFiles []string, outputDir string) (*UpgradeReport, error) {
+	return g.Upgrade(context.Background(), protoFiles, outfs.NewOS(outputDir))
+}
+
+// Upgrade - UpgradeFromProtoFiles для проекта в файловой системе dst
+func (g *Generator) Upgrade(ctx context.Context, protoFiles []string, dst outfs.FS) (*UpgradeReport, error) {
+	g.upgrade = &UpgradeReport{}
+	defer func() { g.upgrade = nil }()
+
+	if err := g.Generate(ctx, protoFiles, dst); err != nil {
+		return nil, err
+	}
+
+	report := g.upgrade
+	var buf bytes.Buffer
+	report.Print(&buf)
+	if err := dst.WriteFile(path.Join(stateDir, upgradeReportFileName), buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to save upgrade report: %w", err)
+	}
+
+	return report, nil
+}
+
+// upgradeFile сливает новую версию файла с пользовательской и возвращает
+// содержимое, которое нужно записать. Пустой результат означает, что файл
+// трогать не нужно.
+func (g *Generator) upgradeFile(dst outfs.FS, relPath string, existing []byte, exists bool, generated []byte) ([]byte, error) {
+	report := UpgradeFile{Path: relPath}
+	defer func() { g.upgrade.Files = append(g.upgrade.Files, report) }()
+
+	if !exists {
+		report.Status = UpgradeCreated
+		return generated, nil
+	}
+	if string(existing) == string(generated) {
+		report.Status = UpgradeUnchanged
+		return nil, nil
+	}
+
+	base, err := fs.ReadFile(dst, basePath(relPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Без общего предка слить нельзя: откладываем новую версию рядом
+		report.Status = UpgradeNoBase
+		pending := path.Join(stateDir, "pending", relPath)
+		if err := dst.WriteFile(pending, generated); err != nil {
+			return nil, fmt.Errorf("failed to save pending version: %w", err)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base version: %w", err)
+	}
+
+	switch {
+	case string(existing) == string(base):
+		report.Status = UpgradeUpdated
+		return generated, nil
+	case string(generated) == string(base):
+		report.Status = UpgradeKept
+		return nil, nil
+	}
+
+	result := merge3(string(base), string(existing), string(generated))
+	report.Status = UpgradeMerged
+	if result.conflicts > 0 {
+		report.Status = UpgradeConflict
+		report.Conflicts = result.conflicts
+	}
+
+	return []byte(result.content), nil
+}
+
+// saveBase запоминает сгенерированную версию файла как общего предка
+// для следующего обновления
+func saveBase(dst outfs.FS, relPath string, content []byte) error {
+	return dst.WriteFile(basePath(relPath), content)
+}
+
+func basePath(relPath string) string {
+	return path.Join(stateDir, baseDir, relPath)
+}
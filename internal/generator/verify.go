@@ -0,0 +1,183 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// VerifyIssue - ошибка компиляции сгенерированного модуля. Template и Model
+// берутся из манифеста и указывают, какой шаблон и для какой модели
+// записал файл с ошибкой.
+type VerifyIssue struct {
+	// File - путь относительно выходной директории, пустой для ошибок
+	// загрузки пакета без позиции
+	File string `json:"file,omitempty"`
+	// Line, Column - позиция ошибки, с единицы; 0, если неизвестна
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Package  string `json:"package"`
+	Template string `json:"template,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Custom - строка принадлежит пользователю: она в защищённой области
+	// или в файле create-only, который генератор больше не перезаписывает
+	Custom  bool   `json:"custom,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i VerifyIssue) String() string {
+	where := i.Package
+	if i.File != "" {
+		where = fmt.Sprintf("%s:%d:%d", i.File, i.Line, i.Column)
+	}
+
+	var origin []string
+	if i.Template != "" {
+		origin = append(origin, "template "+i.Template)
+	}
+	if i.Model != "" {
+		origin = append(origin, "model "+i.Model)
+	}
+	if i.Custom {
+		origin = append(origin, "custom code")
+	}
+	if len(origin) == 0 {
+		return fmt.Sprintf("%s: %s", where, i.Message)
+	}
+	return fmt.Sprintf("%s: %s (%s)", where, i.Message, strings.Join(origin, ", "))
+}
+
+// Verify проверяет типы сгенерированного модуля в dir вместе с тестами
+// через go/packages и возвращает ошибки компиляции. Код proto должен быть
+// уже скомпилирован в dir, а go.mod - содержать все зависимости. Ошибка
+// возвращается, только если проверку не удалось запустить.
+func Verify(ctx context.Context, dir string) ([]VerifyIssue, error) {
+	// Зависимости проверяются из исходников: export data компилятора
+	// новее, чем умеет читать go/packages, привела бы к аварии загрузчика
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes,
+		Tests:   true,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+
+	manifest, err := LoadManifest(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+	// Позиции ошибок go/packages - абсолютные пути
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	v := &verifier{dir: abs, manifest: manifest, sources: make(map[string][]byte), seen: make(map[string]bool)}
+
+	// Тестовые варианты пакета повторяют ошибки основного
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			v.add(pkg.PkgPath, e)
+		}
+	})
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		a, b := v.issues[i], v.issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return v.issues, nil
+}
+
+type verifier struct {
+	dir      string
+	manifest *Manifest
+	sources  map[string][]byte
+	seen     map[string]bool
+	issues   []VerifyIssue
+}
+
+func (v *verifier) add(pkgPath string, e packages.Error) {
+	issue := VerifyIssue{Package: pkgPath, Message: e.Msg}
+	if file, line, column, ok := splitPosition(e.Pos); ok {
+		if rel, err := filepath.Rel(v.dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = filepath.ToSlash(rel)
+		}
+		issue.File, issue.Line, issue.Column = file, line, column
+	}
+
+	key := issue.File + ":" + strconv.Itoa(issue.Line) + ":" + strconv.Itoa(issue.Column) + ":" + issue.Message
+	if v.seen[key] {
+		return
+	}
+	v.seen[key] = true
+
+	if entry := v.entry(issue.File); entry != nil {
+		issue.Template, issue.Model = entry.Template, entry.Model
+		issue.Custom = !entry.Owned() || v.inCustomRegion(issue.File, issue.Line)
+	}
+	v.issues = append(v.issues, issue)
+}
+
+func (v *verifier) entry(path string) *ManifestEntry {
+	for i := range v.manifest.Files {
+		if v.manifest.Files[i].Path == path {
+			return &v.manifest.Files[i]
+		}
+	}
+	return nil
+}
+
+// inCustomRegion сообщает, находится ли строка line файла внутри
+// защищённой области
+func (v *verifier) inCustomRegion(path string, line int) bool {
+	content, ok := v.sources[path]
+	if !ok {
+		content, _ = os.ReadFile(filepath.Join(v.dir, filepath.FromSlash(path)))
+		v.sources[path] = content
+	}
+
+	inside := false
+	for i, text := range splitContentLines(content) {
+		if i+1 == line {
+			return inside
+		}
+		if _, ok := regionBegin(text); ok {
+			inside = true
+		} else if isRegionEnd(text) {
+			inside = false
+		}
+	}
+	return false
+}
+
+// splitPosition разбирает позицию ошибки go/packages: file:line:col или
+// file:line
+func splitPosition(pos string) (file string, line, column int, ok bool) {
+	parts := strings.Split(pos, ":")
+	if len(parts) < 2 {
+		return "", 0, 0, false
+	}
+	if n, err := strconv.Atoi(parts[len(parts)-1]); err == nil && len(parts) >= 3 {
+		if l, err := strconv.Atoi(parts[len(parts)-2]); err == nil {
+			return strings.Join(parts[:len(parts)-2], ":"), l, n, true
+		}
+	}
+	if l, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+		return strings.Join(parts[:len(parts)-1], ":"), l, 0, true
+	}
+	return "", 0, 0, false
+}
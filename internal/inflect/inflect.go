@@ -0,0 +1,195 @@
+// Package inflect склоняет английские существительные для имён таблиц,
+// REST ресурсов и идентификаторов в шаблонах. Пакет используется и
+// генератором proto (cmd/protogen), и шаблонами кода, чтобы имена
+// совпадали во всех слоях.
+package inflect
+
+import (
+	"strings"
+
+	"github.com/iancoleman/strcase"
+)
+
+// irregulars - слова, множественное число которых не строится по правилам
+var irregulars = map[string]string{
+	"person":     "people",
+	"child":      "children",
+	"man":        "men",
+	"woman":      "women",
+	"mouse":      "mice",
+	"goose":      "geese",
+	"tooth":      "teeth",
+	"foot":       "feet",
+	"ox":         "oxen",
+	"criterion":  "criteria",
+	"phenomenon": "phenomena",
+	"datum":      "data",
+	"medium":     "media",
+	"index":      "indices",
+	"matrix":     "matrices",
+	"vertex":     "vertices",
+	"quiz":       "quizzes",
+	"leaf":       "leaves",
+	"knife":      "knives",
+	"life":       "lives",
+	"wife":       "wives",
+	"half":       "halves",
+	"shelf":      "shelves",
+	"wolf":       "wolves",
+	"hero":       "heroes",
+	"potato":     "potatoes",
+	"tomato":     "tomatoes",
+	"echo":       "echoes",
+	"veto":       "vetoes",
+	"cactus":     "cacti",
+	"focus":      "foci",
+	"radius":     "radii",
+	"alumnus":    "alumni",
+}
+
+// uncountables - слова без множественного числа
+var uncountables = map[string]bool{
+	"equipment":   true,
+	"information": true,
+	"metadata":    true,
+	"data":        true,
+	"money":       true,
+	"news":        true,
+	"series":      true,
+	"species":     true,
+	"sheep":       true,
+	"fish":        true,
+	"deer":        true,
+	"rice":        true,
+	"feedback":    true,
+	"software":    true,
+	"inventory":   true,
+	"staff":       true,
+}
+
+var singularIrregulars = func() map[string]string {
+	m := make(map[string]string, len(irregulars))
+	for singular, plural := range irregulars {
+		m[plural] = singular
+	}
+	return m
+}()
+
+// Pluralize возвращает множественное число английского слова.
+// Регистр первой буквы сохраняется.
+func Pluralize(word string) string {
+	if word == "" {
+		return word
+	}
+
+	lower := strings.ToLower(word)
+	if uncountables[lower] {
+		return word
+	}
+	if plural, ok := irregulars[lower]; ok {
+		return matchCase(word, plural)
+	}
+	if _, ok := singularIrregulars[lower]; ok {
+		// Слово уже во множественном числе
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(lower, "sis"):
+		// analysis -> analyses
+		return word[:len(word)-2] + "es"
+	case hasAnySuffix(lower, "s", "x", "z", "ch", "sh"):
+		return word + "es"
+	case strings.HasSuffix(lower, "y") && !isVowel(lower, len(lower)-2):
+		return word[:len(word)-1] + "ies"
+	default:
+		return word + "s"
+	}
+}
+
+// Singularize возвращает единственное число английского слова
+func Singularize(word string) string {
+	if word == "" {
+		return word
+	}
+
+	lower := strings.ToLower(word)
+	if uncountables[lower] {
+		return word
+	}
+	if singular, ok := singularIrregulars[lower]; ok {
+		return matchCase(word, singular)
+	}
+	if _, ok := irregulars[lower]; ok {
+		// Слово уже в единственном числе
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(lower) > 3:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(lower, "yses"):
+		// analyses -> analysis
+		return word[:len(word)-2] + "is"
+	case strings.HasSuffix(lower, "uses") && !isVowel(lower, len(lower)-5):
+		// statuses -> status, но houses -> house
+		return word[:len(word)-2]
+	case hasAnySuffix(lower, "sses", "xes", "zes", "ches", "shes"):
+		return word[:len(word)-2]
+	case hasAnySuffix(lower, "ss", "us", "is"):
+		return word
+	case strings.HasSuffix(lower, "s"):
+		return word[:len(word)-1]
+	default:
+		return word
+	}
+}
+
+// TableName возвращает имя таблицы для сообщения: snake_case во
+// множественном числе, склоняется только последнее слово
+// (DeliveryZone -> delivery_zones, Person -> people)
+func TableName(name string) string {
+	return pluralizeLast(strcase.ToSnake(name), "_")
+}
+
+// ResourceName возвращает имя REST ресурса для сообщения: kebab-case во
+// множественном числе (DeliveryZone -> delivery-zones)
+func ResourceName(name string) string {
+	return pluralizeLast(strcase.ToKebab(name), "-")
+}
+
+func pluralizeLast(name, sep string) string {
+	parts := strings.Split(name, sep)
+	parts[len(parts)-1] = Pluralize(parts[len(parts)-1])
+	return strings.Join(parts, sep)
+}
+
+// matchCase переносит регистр первой буквы исходного слова на результат
+func matchCase(original, word string) string {
+	if original == "" || word == "" {
+		return word
+	}
+	if strings.ToUpper(original) == original && len(original) > 1 {
+		return strings.ToUpper(word)
+	}
+	if original[0] >= 'A' && original[0] <= 'Z' {
+		return strings.ToUpper(word[:1]) + word[1:]
+	}
+	return word
+}
+
+func hasAnySuffix(s string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isVowel(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	return strings.ContainsRune("aeiou", rune(s[i]))
+}
@@ -0,0 +1,90 @@
+package inflect
+
+import "testing"
+
+func TestPluralize(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"", ""},
+		{"courier", "couriers"},
+		{"box", "boxes"},
+		{"status", "statuses"},
+		{"branch", "branches"},
+		{"wish", "wishes"},
+		{"category", "categories"},
+		{"day", "days"},
+		{"analysis", "analyses"},
+		{"person", "people"},
+		{"Person", "People"},
+		{"PERSON", "PEOPLE"},
+		{"index", "indices"},
+		{"people", "people"},
+		{"equipment", "equipment"},
+		{"Metadata", "Metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := Pluralize(tt.word); got != tt.want {
+				t.Errorf("Pluralize(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSingularize(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"", ""},
+		{"couriers", "courier"},
+		{"boxes", "box"},
+		{"statuses", "status"},
+		{"houses", "house"},
+		{"addresses", "address"},
+		{"branches", "branch"},
+		{"categories", "category"},
+		{"analyses", "analysis"},
+		{"People", "Person"},
+		{"person", "person"},
+		{"status", "status"},
+		{"news", "news"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := Singularize(tt.word); got != tt.want {
+				t.Errorf("Singularize(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableAndResourceName(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    string
+		resource string
+	}{
+		{"Courier", "couriers", "couriers"},
+		{"DeliveryZone", "delivery_zones", "delivery-zones"},
+		{"SalesPerson", "sales_people", "sales-people"},
+		{"OrderStatus", "order_statuses", "order-statuses"},
+		{"InventoryCategory", "inventory_categories", "inventory-categories"},
+		{"StaffEquipment", "staff_equipment", "staff-equipment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TableName(tt.name); got != tt.table {
+				t.Errorf("TableName(%q) = %q, want %q", tt.name, got, tt.table)
+			}
+			if got := ResourceName(tt.name); got != tt.resource {
+				t.Errorf("ResourceName(%q) = %q, want %q", tt.name, got, tt.resource)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Package logging настраивает журнал консольных команд генератора
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// New создаёт журнал в stderr: quiet оставляет предупреждения и ошибки,
+// verbose добавляет отладочные сообщения генератора, format - text или json
+func New(quiet, verbose bool, format string) (*slog.Logger, error) {
+	if quiet && verbose {
+		return nil, fmt.Errorf("-q and -v cannot be combined")
+	}
+
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	switch {
+	case quiet:
+		opts.Level = slog.LevelWarn
+	case verbose:
+		opts.Level = slog.LevelDebug
+	}
+
+	switch format {
+	case "text":
+		// Время в журнале консольной команды только мешает читать
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+}
@@ -0,0 +1,78 @@
+// Package modpath выводит из пути Go модуля генерируемого сервиса имя
+// proto пакета и go_package. Пакет используется и генератором proto
+// (cmd/protogen), и генератором кода, чтобы импорты совпадали.
+package modpath
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// Default - модуль по умолчанию. Для него сохраняется прежний proto
+// пакет "proto", чтобы не менять полные имена gRPC сервисов.
+const Default = "app"
+
+// majorVersion - суффикс мажорной версии в пути модуля (v2, v3, ...)
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// Check проверяет, что путь можно использовать как путь модуля в go.mod
+func Check(path string) error {
+	if err := module.CheckImportPath(path); err != nil {
+		return fmt.Errorf("invalid module path: %w", err)
+	}
+	return nil
+}
+
+// ProtoImport возвращает Go пакет сгенерированных proto сообщений
+func ProtoImport(path string) string {
+	return path + "/internal/proto"
+}
+
+// ProtoPackage возвращает имя proto пакета для модуля:
+// github.com/mycorp/courier -> mycorp.courier.v1,
+// github.com/mycorp/courier/v2 -> mycorp.courier.v2.
+// Хост в начале пути отбрасывается, версия по умолчанию v1.
+func ProtoPackage(path string) string {
+	if path == Default {
+		return "proto"
+	}
+
+	elems := strings.Split(path, "/")
+	if len(elems) > 1 && strings.Contains(elems[0], ".") {
+		elems = elems[1:]
+	}
+
+	version := "v1"
+	if last := elems[len(elems)-1]; len(elems) > 1 && majorVersion.MatchString(last) {
+		version = last
+		elems = elems[:len(elems)-1]
+	}
+
+	parts := make([]string, 0, len(elems)+1)
+	for _, elem := range elems {
+		parts = append(parts, protoIdent(elem))
+	}
+	return strings.Join(append(parts, version), ".")
+}
+
+// protoIdent превращает элемент пути в допустимую часть имени proto пакета
+func protoIdent(s string) string {
+	var b strings.Builder
+	for i, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package modpath
+
+import "testing"
+
+func TestProtoPackage(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{Default, "proto"},
+		{"github.com/mycorp/courier", "mycorp.courier.v1"},
+		{"github.com/mycorp/courier/v2", "mycorp.courier.v2"},
+		{"example.com/shop", "shop.v1"},
+		{"shop", "shop.v1"},
+		{"v2", "v2.v1"},
+		{"gitlab.com/my-corp/Delivery.API", "my_corp.delivery_api.v1"},
+		{"example.com/3pl/courier", "_3pl.courier.v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ProtoPackage(tt.path); got != tt.want {
+				t.Errorf("ProtoPackage(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: Default},
+		{path: "github.com/mycorp/courier/v2"},
+		{path: "", wantErr: true},
+		{path: "/abs/path", wantErr: true},
+		{path: "github.com/my corp/courier", wantErr: true},
+		{path: "github.com/mycorp/../courier", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := Check(tt.path); (err != nil) != tt.wantErr {
+				t.Errorf("Check(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProtoImport(t *testing.T) {
+	if got, want := ProtoImport("example.com/shop"), "example.com/shop/internal/proto"; got != want {
+		t.Errorf("ProtoImport() = %q, want %q", got, want)
+	}
+}
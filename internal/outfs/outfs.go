@@ -0,0 +1,212 @@
+// Package outfs содержит файловые системы, в которые генератор записывает
+// проект: директорию на диске, память, zip архив и пробный запуск поверх
+// любой из них.
+package outfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing/fstest"
+	"time"
+)
+
+// FS - выходная файловая система генератора. Пути относительные, через
+// "/", как в io/fs. Файлы читаются через fs.FS, поэтому подходят
+// fs.ReadFile, fs.Stat и fs.Glob.
+type FS interface {
+	fs.FS
+	// WriteFile записывает файл, создавая недостающие директории
+	WriteFile(name string, data []byte) error
+	// Remove удаляет файл
+	Remove(name string) error
+}
+
+// OS - файловая система в директории на диске
+type OS struct {
+	fs.FS
+	dir string
+}
+
+// NewOS возвращает файловую систему в директории dir
+func NewOS(dir string) *OS {
+	return &OS{FS: os.DirFS(dir), dir: dir}
+}
+
+// Dir возвращает директорию файловой системы
+func (o *OS) Dir() string {
+	return o.dir
+}
+
+func (o *OS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	full := filepath.Join(o.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return os.WriteFile(full, data, 0644)
+}
+
+func (o *OS) Remove(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Remove(filepath.Join(o.dir, filepath.FromSlash(name)))
+}
+
+// Memory - файловая система в памяти: для тестов, предпросмотра и сборки
+// архивов. Не предназначена для одновременного использования.
+type Memory struct {
+	files fstest.MapFS
+}
+
+// NewMemory возвращает пустую файловую систему в памяти
+func NewMemory() *Memory {
+	return &Memory{files: fstest.MapFS{}}
+}
+
+func (m *Memory) Open(name string) (fs.File, error) {
+	return m.files.Open(name)
+}
+
+func (m *Memory) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.files[name] = &fstest.MapFile{
+		Data:    bytes.Clone(data),
+		Mode:    0644,
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+func (m *Memory) Remove(name string) error {
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// Files возвращает пути всех файлов по алфавиту
+func (m *Memory) Files() []string {
+	paths := make([]string, 0, len(m.files))
+	for name := range m.files {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Zip собирает файлы в памяти и при Close записывает их zip архивом.
+// Архив каждый раз собирается с нуля, как новая директория.
+type Zip struct {
+	*Memory
+	w io.Writer
+}
+
+// NewZip возвращает файловую систему, которая запишет архив в w
+func NewZip(w io.Writer) *Zip {
+	return &Zip{Memory: NewMemory(), w: w}
+}
+
+// Close записывает архив со всеми файлами по алфавиту
+func (z *Zip) Close() error {
+	zw := zip.NewWriter(z.w)
+	for _, name := range z.Files() {
+		file := z.files[name]
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: file.ModTime}
+		header.SetMode(file.Mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+		if _, err := w.Write(file.Data); err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// DryRun - файловая система пробного запуска: читает файлы из base, а
+// записи и удаления держит в памяти, не трогая base
+type DryRun struct {
+	base    fs.FS
+	written *Memory
+	removed map[string]bool
+}
+
+// NewDryRun возвращает файловую систему пробного запуска поверх base
+func NewDryRun(base fs.FS) *DryRun {
+	return &DryRun{base: base, written: NewMemory(), removed: map[string]bool{}}
+}
+
+func (d *DryRun) Open(name string) (fs.File, error) {
+	if d.removed[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if _, ok := d.written.files[name]; ok {
+		return d.written.Open(name)
+	}
+	return d.base.Open(name)
+}
+
+// ReadDir объединяет записи base и файлы, записанные пробным запуском
+func (d *DryRun) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(d.base, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	written, werr := fs.ReadDir(d.written.files, name)
+	if err != nil && werr != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]fs.DirEntry, len(entries)+len(written))
+	for _, e := range entries {
+		if !d.removed[path.Join(name, e.Name())] {
+			byName[e.Name()] = e
+		}
+	}
+	for _, e := range written {
+		byName[e.Name()] = e
+	}
+	merged := make([]fs.DirEntry, 0, len(byName))
+	for _, e := range byName {
+		merged = append(merged, e)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+func (d *DryRun) WriteFile(name string, data []byte) error {
+	if err := d.written.WriteFile(name, data); err != nil {
+		return err
+	}
+	delete(d.removed, name)
+	return nil
+}
+
+func (d *DryRun) Remove(name string) error {
+	if _, err := fs.Stat(d, name); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(d.written.files, name)
+	d.removed[name] = true
+	return nil
+}
+
+// Written возвращает файлы, которые пробный запуск записал бы
+func (d *DryRun) Written() *Memory {
+	return d.written
+}
@@ -0,0 +1,246 @@
+// Package protoc компилирует выходные proto файлы сервиса в Go код без
+// внешнего protoc. Файлы разбираются protoload, protoc-gen-go выполняется в
+// процессе, а плагины gRPC и gateway запускаются как отдельные программы и
+// получают CodeGeneratorRequest через stdin, как от protoc.
+package protoc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+
+	"generator/internal/protoload"
+)
+
+// parameter - параметры плагинов, Go файлы кладутся рядом с proto
+const parameter = "paths=source_relative"
+
+// annotationsPackage - Go пакет google/api/*.proto. Встроенные дескрипторы
+// этих файлов собраны без go_package, а плагинам он нужен для импортов.
+const annotationsPackage = "google.golang.org/genproto/googleapis/api/annotations"
+
+// Plugin - внешний плагин protoc
+type Plugin struct {
+	// Name - имя исполняемого файла
+	Name string
+	// Install - пакет для go install с версией, совместимой с шаблонами
+	Install string
+}
+
+var (
+	// GRPCPlugin генерирует серверы и клиенты gRPC
+	GRPCPlugin = Plugin{
+		Name:    "protoc-gen-go-grpc",
+		Install: "google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.3.0",
+	}
+	// GatewayPlugin генерирует обработчики HTTP gateway
+	GatewayPlugin = Plugin{
+		Name:    "protoc-gen-grpc-gateway",
+		Install: "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-grpc-gateway@v2.19.1",
+	}
+)
+
+// Options - настройки компиляции
+type Options struct {
+	// Dir - директория выходных proto файлов, Go код пишется туда же
+	Dir string
+	// Gateway - генерировать обработчики HTTP gateway
+	Gateway bool
+}
+
+// Generate компилирует все *.proto из opts.Dir и записывает Go код рядом с ними
+func Generate(ctx context.Context, opts Options) error {
+	matches, err := filepath.Glob(filepath.Join(opts.Dir, "*.proto"))
+	if err != nil {
+		return fmt.Errorf("failed to list proto files: %w", err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no proto files in %s", opts.Dir)
+	}
+	files := make([]string, 0, len(matches))
+	for _, match := range matches {
+		files = append(files, filepath.Base(match))
+	}
+
+	set, err := protoload.Load(ctx, files, []string{opts.Dir})
+	if err != nil {
+		return fmt.Errorf("failed to compile proto files: %w", err)
+	}
+	req, err := newRequest(set, files)
+	if err != nil {
+		return err
+	}
+
+	plugins := []Plugin{GRPCPlugin}
+	if opts.Gateway {
+		plugins = append(plugins, GatewayPlugin)
+	}
+	// Плагины ищутся заранее, чтобы не оставлять наполовину обновлённый код
+	paths := make([]string, len(plugins))
+	for i, plugin := range plugins {
+		if paths[i], err = lookPlugin(plugin); err != nil {
+			return err
+		}
+	}
+
+	resp, err := generateGo(req)
+	if err != nil {
+		return fmt.Errorf("protoc-gen-go: %w", err)
+	}
+	responses := []*pluginpb.CodeGeneratorResponse{resp}
+	for i, plugin := range plugins {
+		resp, err := runPlugin(ctx, paths[i], req)
+		if err != nil {
+			return fmt.Errorf("%s: %w", plugin.Name, err)
+		}
+		responses = append(responses, resp)
+	}
+
+	for _, resp := range responses {
+		if err := writeResponse(opts.Dir, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newRequest собирает запрос к плагинам: файлы для генерации и все их
+// зависимости в порядке импорта
+func newRequest(set *protoload.Set, files []string) (*pluginpb.CodeGeneratorRequest, error) {
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: files,
+		Parameter:      proto.String(parameter),
+	}
+
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+
+		fdp := protodesc.ToFileDescriptorProto(fd)
+		if strings.HasPrefix(fd.Path(), "google/api/") {
+			if fdp.Options == nil {
+				fdp.Options = &descriptorpb.FileOptions{}
+			}
+			fdp.Options.GoPackage = proto.String(annotationsPackage)
+		}
+		req.ProtoFile = append(req.ProtoFile, fdp)
+	}
+
+	for _, path := range files {
+		fd, err := set.File(path)
+		if err != nil {
+			return nil, err
+		}
+		add(fd)
+	}
+	return req, nil
+}
+
+// generateGo выполняет protoc-gen-go в процессе
+func generateGo(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range gen.Files {
+		if f.Generate {
+			internal_gengo.GenerateFile(gen, f)
+		}
+	}
+	gen.SupportedFeatures = internal_gengo.SupportedFeatures
+	return gen.Response(), nil
+}
+
+// runPlugin запускает внешний плагин и передаёт ему запрос через stdin
+func runPlugin(ctx context.Context, path string, req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	input, err := proto.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	resp := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp, nil
+}
+
+// writeResponse записывает файлы из ответа плагина
+func writeResponse(dir string, resp *pluginpb.CodeGeneratorResponse) error {
+	if resp.Error != nil {
+		return errors.New(resp.GetError())
+	}
+	for _, f := range resp.File {
+		if f.GetInsertionPoint() != "" {
+			return fmt.Errorf("insertion points are not supported: %s", f.GetName())
+		}
+		path := filepath.Join(dir, filepath.FromSlash(f.GetName()))
+		// Неизменившиеся файлы не трогаем, чтобы не сбивать время изменения
+		if existing, err := os.ReadFile(path); err == nil && string(existing) == f.GetContent() {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(f.GetContent()), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// lookPlugin ищет плагин в PATH, а затем в директории go install
+func lookPlugin(plugin Plugin) (string, error) {
+	if path, err := exec.LookPath(plugin.Name); err == nil {
+		return path, nil
+	}
+
+	dirs := []string{os.Getenv("GOBIN")}
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		dirs = append(dirs, filepath.Join(gopath, "bin"))
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if path, err := exec.LookPath(filepath.Join(dir, plugin.Name)); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found, install it with: go install %s", plugin.Name, plugin.Install)
+}
@@ -0,0 +1,521 @@
+package protogen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"generator/internal/protoload"
+)
+
+// printer печатает дескрипторы исходного proto файла обратно в синтаксис proto.
+// Типы исходного пакета печатаются без префикса пакета, потому что в выходном
+// файле они объявлены в пакете сервиса.
+type printer struct {
+	set  *protoload.Set
+	file protoreflect.FileDescriptor
+	buf  strings.Builder
+}
+
+func newPrinter(set *protoload.Set, file protoreflect.FileDescriptor) *printer {
+	return &printer{set: set, file: file}
+}
+
+func (p *printer) String() string {
+	return p.buf.String()
+}
+
+// definitions печатает все сообщения, перечисления и расширения файла
+// в порядке их объявления в исходнике
+func (p *printer) definitions() string {
+	var decls []protoreflect.Descriptor
+	messages := p.file.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		decls = append(decls, messages.Get(i))
+	}
+	enums := p.file.Enums()
+	for i := 0; i < enums.Len(); i++ {
+		decls = append(decls, enums.Get(i))
+	}
+	p.sortBySource(decls)
+
+	for i, d := range decls {
+		if i > 0 {
+			p.buf.WriteString("\n")
+		}
+		switch d := d.(type) {
+		case protoreflect.MessageDescriptor:
+			p.message(d, "")
+		case protoreflect.EnumDescriptor:
+			p.enum(d, "")
+		}
+	}
+
+	p.extensions(p.file.Extensions(), "")
+
+	return p.String()
+}
+
+// fileOptions возвращает опции файла в виде "name = value", кроме go_package
+// и опций appgen
+func (p *printer) fileOptions() []string {
+	var result []string
+	for _, opt := range p.optionList(p.file.Options()) {
+		if opt.name == "go_package" {
+			continue
+		}
+		result = append(result, opt.String())
+	}
+	return result
+}
+
+func (p *printer) message(md protoreflect.MessageDescriptor, indent string) {
+	p.leadingComments(md, indent)
+	fmt.Fprintf(&p.buf, "%smessage %s {%s\n", indent, md.Name(), p.trailingComment(md))
+
+	inner := indent + "  "
+	for _, opt := range p.optionList(md.Options()) {
+		fmt.Fprintf(&p.buf, "%soption %s;\n", inner, opt)
+	}
+
+	// Поля, oneof, вложенные типы печатаем в порядке объявления
+	var decls []protoreflect.Descriptor
+	fields := md.Fields()
+	printedOneofs := make(map[protoreflect.FullName]bool)
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+			if !printedOneofs[od.FullName()] {
+				printedOneofs[od.FullName()] = true
+				decls = append(decls, od)
+			}
+			continue
+		}
+		decls = append(decls, fd)
+	}
+	nested := md.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		if !nested.Get(i).IsMapEntry() {
+			decls = append(decls, nested.Get(i))
+		}
+	}
+	enums := md.Enums()
+	for i := 0; i < enums.Len(); i++ {
+		decls = append(decls, enums.Get(i))
+	}
+	p.sortBySource(decls)
+
+	for _, d := range decls {
+		switch d := d.(type) {
+		case protoreflect.FieldDescriptor:
+			p.field(d, inner)
+		case protoreflect.OneofDescriptor:
+			p.oneof(d, inner)
+		case protoreflect.MessageDescriptor:
+			p.message(d, inner)
+		case protoreflect.EnumDescriptor:
+			p.enum(d, inner)
+		}
+	}
+
+	p.extensions(md.Extensions(), inner)
+	p.reserved(md.ReservedRanges(), md.ReservedNames(), inner, true)
+
+	fmt.Fprintf(&p.buf, "%s}\n", indent)
+}
+
+func (p *printer) oneof(od protoreflect.OneofDescriptor, indent string) {
+	p.leadingComments(od, indent)
+	fmt.Fprintf(&p.buf, "%soneof %s {%s\n", indent, od.Name(), p.trailingComment(od))
+
+	inner := indent + "  "
+	for _, opt := range p.optionList(od.Options()) {
+		fmt.Fprintf(&p.buf, "%soption %s;\n", inner, opt)
+	}
+	fields := od.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		p.field(fields.Get(i), inner)
+	}
+
+	fmt.Fprintf(&p.buf, "%s}\n", indent)
+}
+
+func (p *printer) field(fd protoreflect.FieldDescriptor, indent string) {
+	p.leadingComments(fd, indent)
+	fmt.Fprintf(&p.buf, "%s%s%s;%s\n", indent, p.fieldDecl(fd), p.fieldOptions(fd), p.trailingComment(fd))
+}
+
+// fieldDecl печатает метку, тип, имя и номер поля
+func (p *printer) fieldDecl(fd protoreflect.FieldDescriptor) string {
+	var label string
+	switch {
+	case fd.IsMap():
+		return fmt.Sprintf("map<%s, %s> %s = %d",
+			p.typeName(fd.MapKey()), p.typeName(fd.MapValue()), fd.Name(), fd.Number())
+	case fd.Cardinality() == protoreflect.Repeated:
+		label = "repeated "
+	case fd.Cardinality() == protoreflect.Required:
+		label = "required "
+	case fd.HasOptionalKeyword():
+		label = "optional "
+	}
+	return fmt.Sprintf("%s%s %s = %d", label, p.typeName(fd), fd.Name(), fd.Number())
+}
+
+func (p *printer) fieldOptions(fd protoreflect.FieldDescriptor) string {
+	var opts []string
+	if fd.HasDefault() {
+		opts = append(opts, "default = "+formatValue(fd, fd.Default()))
+	}
+	// Компилятор заполняет json_name для всех полей, печатаем только заданные явно
+	if fd.HasJSONName() && fd.JSONName() != defaultJSONName(string(fd.Name())) {
+		opts = append(opts, "json_name = "+strconv.Quote(fd.JSONName()))
+	}
+	for _, opt := range p.optionList(fd.Options()) {
+		opts = append(opts, opt.String())
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(opts, ", ") + "]"
+}
+
+func (p *printer) enum(ed protoreflect.EnumDescriptor, indent string) {
+	p.leadingComments(ed, indent)
+	fmt.Fprintf(&p.buf, "%senum %s {%s\n", indent, ed.Name(), p.trailingComment(ed))
+
+	inner := indent + "  "
+	for _, opt := range p.optionList(ed.Options()) {
+		fmt.Fprintf(&p.buf, "%soption %s;\n", inner, opt)
+	}
+
+	values := ed.Values()
+	for i := 0; i < values.Len(); i++ {
+		vd := values.Get(i)
+		p.leadingComments(vd, inner)
+
+		var opts []string
+		for _, opt := range p.optionList(vd.Options()) {
+			opts = append(opts, opt.String())
+		}
+		optText := ""
+		if len(opts) > 0 {
+			optText = " [" + strings.Join(opts, ", ") + "]"
+		}
+		fmt.Fprintf(&p.buf, "%s%s = %d%s;%s\n", inner, vd.Name(), vd.Number(), optText, p.trailingComment(vd))
+	}
+
+	p.reserved(ed.ReservedRanges(), ed.ReservedNames(), inner, false)
+
+	fmt.Fprintf(&p.buf, "%s}\n", indent)
+}
+
+// service печатает объявление сервиса вместе с методами
+func (p *printer) service(sd protoreflect.ServiceDescriptor) {
+	p.leadingComments(sd, "")
+	fmt.Fprintf(&p.buf, "service %s {%s\n", sd.Name(), p.trailingComment(sd))
+
+	opts := p.optionList(sd.Options())
+	for _, opt := range opts {
+		fmt.Fprintf(&p.buf, "  option %s;\n", opt)
+	}
+
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		if i > 0 || len(opts) > 0 {
+			p.buf.WriteString("\n")
+		}
+		p.method(methods.Get(i), "  ")
+	}
+
+	p.buf.WriteString("}\n")
+}
+
+// method печатает объявление rpc
+func (p *printer) method(md protoreflect.MethodDescriptor, indent string) {
+	input := p.relativeName(md.Input().FullName())
+	if md.IsStreamingClient() {
+		input = "stream " + input
+	}
+	output := p.relativeName(md.Output().FullName())
+	if md.IsStreamingServer() {
+		output = "stream " + output
+	}
+
+	p.leadingComments(md, indent)
+	decl := fmt.Sprintf("%srpc %s(%s) returns (%s)", indent, md.Name(), input, output)
+
+	opts := p.optionList(md.Options())
+	if len(opts) == 0 {
+		fmt.Fprintf(&p.buf, "%s;%s\n", decl, p.trailingComment(md))
+		return
+	}
+
+	fmt.Fprintf(&p.buf, "%s {%s\n", decl, p.trailingComment(md))
+	for _, opt := range opts {
+		fmt.Fprintf(&p.buf, "%s  option %s;\n", indent, opt)
+	}
+	fmt.Fprintf(&p.buf, "%s}\n", indent)
+}
+
+// extensions печатает блоки extend, сгруппированные по расширяемому сообщению
+func (p *printer) extensions(exts protoreflect.ExtensionDescriptors, indent string) {
+	if exts.Len() == 0 {
+		return
+	}
+
+	var order []protoreflect.FullName
+	byTarget := make(map[protoreflect.FullName][]protoreflect.FieldDescriptor)
+	for i := 0; i < exts.Len(); i++ {
+		xd := exts.Get(i)
+		target := xd.ContainingMessage().FullName()
+		if _, ok := byTarget[target]; !ok {
+			order = append(order, target)
+		}
+		byTarget[target] = append(byTarget[target], xd)
+	}
+
+	for _, target := range order {
+		fmt.Fprintf(&p.buf, "\n%sextend %s {\n", indent, p.relativeName(target))
+		for _, xd := range byTarget[target] {
+			p.field(xd, indent+"  ")
+		}
+		fmt.Fprintf(&p.buf, "%s}\n", indent)
+	}
+}
+
+// reserved печатает зарезервированные номера и имена. Диапазоны сообщений
+// хранятся с исключающей верхней границей, диапазоны enum - с включающей.
+func (p *printer) reserved(ranges interface{}, names protoreflect.Names, indent string, exclusiveEnd bool) {
+	var parts []string
+	switch r := ranges.(type) {
+	case protoreflect.FieldRanges:
+		for i := 0; i < r.Len(); i++ {
+			parts = append(parts, formatRange(int64(r.Get(i)[0]), int64(r.Get(i)[1]), exclusiveEnd))
+		}
+	case protoreflect.EnumRanges:
+		for i := 0; i < r.Len(); i++ {
+			parts = append(parts, formatRange(int64(r.Get(i)[0]), int64(r.Get(i)[1]), exclusiveEnd))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(&p.buf, "%sreserved %s;\n", indent, strings.Join(parts, ", "))
+	}
+
+	if names.Len() > 0 {
+		quoted := make([]string, names.Len())
+		for i := 0; i < names.Len(); i++ {
+			quoted[i] = strconv.Quote(string(names.Get(i)))
+		}
+		fmt.Fprintf(&p.buf, "%sreserved %s;\n", indent, strings.Join(quoted, ", "))
+	}
+}
+
+// defaultJSONName повторяет правило protoc для json_name по умолчанию
+func defaultJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper && r >= 'a' && r <= 'z':
+			b.WriteRune(r - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteRune(r)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+func formatRange(start, end int64, exclusiveEnd bool) string {
+	if exclusiveEnd {
+		end--
+	}
+	switch {
+	case start == end:
+		return strconv.FormatInt(start, 10)
+	case end >= 536870911:
+		return fmt.Sprintf("%d to max", start)
+	default:
+		return fmt.Sprintf("%d to %d", start, end)
+	}
+}
+
+// typeName возвращает имя типа поля так, как оно записывается в proto
+func (p *printer) typeName(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		return p.relativeName(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		return p.relativeName(fd.Enum().FullName())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+// relativeName убирает префикс исходного пакета у имён типов
+func (p *printer) relativeName(name protoreflect.FullName) string {
+	pkg := string(p.file.Package())
+	if pkg != "" && strings.HasPrefix(string(name), pkg+".") {
+		return strings.TrimPrefix(string(name), pkg+".")
+	}
+	return string(name)
+}
+
+func (p *printer) leadingComments(d protoreflect.Descriptor, indent string) {
+	loc := p.file.SourceLocations().ByDescriptor(d)
+	for _, detached := range loc.LeadingDetachedComments {
+		p.buf.WriteString(formatComment(detached, indent))
+		p.buf.WriteString("\n")
+	}
+	if loc.LeadingComments != "" {
+		p.buf.WriteString(formatComment(loc.LeadingComments, indent))
+	}
+}
+
+// trailingComment возвращает однострочный комментарий после объявления
+func (p *printer) trailingComment(d protoreflect.Descriptor) string {
+	comment := strings.TrimSpace(p.file.SourceLocations().ByDescriptor(d).TrailingComments)
+	if comment == "" {
+		return ""
+	}
+	return " // " + strings.ReplaceAll(comment, "\n", " ")
+}
+
+func formatComment(comment, indent string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(comment, "\n"), "\n") {
+		b.WriteString(strings.TrimRight(indent+"//"+line, " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (p *printer) sortBySource(decls []protoreflect.Descriptor) {
+	locs := p.file.SourceLocations()
+	sort.SliceStable(decls, func(i, j int) bool {
+		a, b := locs.ByDescriptor(decls[i]), locs.ByDescriptor(decls[j])
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.StartColumn < b.StartColumn
+	})
+}
+
+// option - одна опция дескриптора
+type option struct {
+	name  string
+	value string
+}
+
+func (o option) String() string {
+	return o.name + " = " + o.value
+}
+
+// optionList возвращает заданные опции дескриптора, включая пользовательские
+// расширения. Опции appgen пропускаются.
+func (p *printer) optionList(opts interface{ ProtoReflect() protoreflect.Message }) []option {
+	msg := p.set.Options(opts)
+	if msg == nil {
+		return nil
+	}
+
+	var result []option
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if protoload.IsAppgenOption(fd) {
+			return true
+		}
+		// Эти опции задаются синтаксисом поля, а не через option
+		if fd.Name() == "map_entry" || fd.Name() == "uninterpreted_option" {
+			return true
+		}
+
+		name := string(fd.Name())
+		if fd.IsExtension() {
+			name = "(" + p.relativeName(fd.FullName()) + ")"
+		}
+
+		if fd.IsList() {
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				result = append(result, option{name: name, value: formatValue(fd, list.Get(i))})
+			}
+			return true
+		}
+		result = append(result, option{name: name, value: formatValue(fd, v)})
+		return true
+	})
+
+	sort.SliceStable(result, func(i, j int) bool {
+		// Стандартные опции печатаем перед расширениями
+		return !strings.HasPrefix(result[i].name, "(") && strings.HasPrefix(result[j].name, "(")
+	})
+	return result
+}
+
+// formatValue печатает значение опции в синтаксисе proto
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return strconv.Quote(v.String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(string(v.Bytes()))
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "{" + formatMessage(v.Message()) + "}"
+	default:
+		return v.String()
+	}
+}
+
+// formatMessage печатает значение-сообщение в текстовом формате protobuf.
+// prototext не подходит: его вывод намеренно нестабилен.
+func formatMessage(m protoreflect.Message) string {
+	// Поля печатаем в порядке номеров: порядок Range не определён
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Number() < fields[j].Number() })
+
+	var parts []string
+	for _, fd := range fields {
+		v := m.Get(fd)
+		name := string(fd.Name())
+		if fd.IsExtension() {
+			name = "[" + string(fd.FullName()) + "]"
+		}
+
+		values := []protoreflect.Value{v}
+		if fd.IsList() {
+			values = values[:0]
+			for i := 0; i < v.List().Len(); i++ {
+				values = append(values, v.List().Get(i))
+			}
+		}
+
+		for _, item := range values {
+			if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+				parts = append(parts, name+" "+formatValue(fd, item))
+			} else {
+				parts = append(parts, name+": "+formatValue(fd, item))
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, " ") + " "
+}
@@ -0,0 +1,552 @@
+// Package protogen строит proto файлы сервиса из исходных proto: переносит
+// типы исходных файлов и добавляет CRUD сервисы для сущностей.
+package protogen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/iancoleman/strcase"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"generator/internal/inflect"
+	"generator/internal/modpath"
+	"generator/internal/protoload"
+)
+
+type ProtoGen struct {
+	sourceDir string
+	outputDir string
+	// protoPackage и goPackage - пакет выходных proto файлов
+	protoPackage string
+	goPackage    string
+	// importPaths - дополнительные директории для импортов
+	importPaths []string
+	// overrides - параметры сообщений из файла настроек
+	overrides map[string]protoload.Override
+	// legacyEntities - сервис получает каждое сообщение, кроме *Request и
+	// *Response, как и в парсере генератора
+	legacyEntities bool
+
+	logger *slog.Logger
+}
+
+const commonProtoTemplate = `syntax = "proto3";
+
+package {{.ProtoPackage}};
+
+option go_package = "{{.GoPackage}}";
+
+// EmptyResponse message used for operations that don't return data
+message EmptyResponse {}`
+
+const serviceProtoTemplate = `syntax = "{{.Syntax}}";
+
+package {{.ProtoPackage}};
+{{range .Imports}}
+import "{{.}}";
+{{- end}}
+
+option go_package = "{{.GoPackage}}";
+{{- range .FileOptions}}
+option {{.}};
+{{- end}}
+
+{{.Definitions}}{{range .Services}}{{$svc := .}}{{$api := .API}}
+{{- if $api.Has "Create"}}
+// Create request
+message Create{{.ServiceName}}Request {
+  {{.ServiceName}} {{.ServiceField}} = 1;
+}
+{{end}}
+{{- if $api.Has "Get"}}
+// Get request
+message Get{{.ServiceName}}Request {
+{{- range $i, $k := .Key}}
+  {{$k.Type}} {{$k.Name}} = {{idx $i}};
+{{- end}}
+}
+{{end}}
+{{- if $api.Has "List"}}
+// List request
+message List{{.ServiceName}}Request {}
+
+// List response
+message List{{.ServiceName}}Response {
+  repeated {{.ServiceName}} items = 1;
+}
+{{end}}
+{{- if $api.Has "Update"}}
+// Update request
+message Update{{.ServiceName}}Request {
+{{- range $i, $k := .Key}}
+  {{$k.Type}} {{$k.Name}} = {{idx $i}};
+{{- end}}
+  {{.ServiceName}} {{.ServiceField}} = {{idx (len .Key)}};
+}
+{{end}}
+{{- if $api.Has "Delete"}}
+// Delete request
+message Delete{{.ServiceName}}Request {
+{{- range $i, $k := .Key}}
+  {{$k.Type}} {{$k.Name}} = {{idx $i}};
+{{- end}}
+}
+{{end}}
+{{- if $api.Has "BatchCreate"}}
+// Batch create request
+message BatchCreate{{.ServiceName}}Request {
+  repeated {{.ServiceName}} items = 1;
+}
+
+// Batch create response
+message BatchCreate{{.ServiceName}}Response {
+  repeated {{.ServiceName}} items = 1;
+}
+{{end}}
+{{- if $api.Has "BatchGet"}}
+// Batch get request
+message BatchGet{{.ServiceName}}Request {
+  repeated {{(index .Key 0).Type}} ids = 1;
+}
+
+// Batch get response
+message BatchGet{{.ServiceName}}Response {
+  repeated {{.ServiceName}} items = 1;
+}
+{{end}}
+{{- if $api.Has "BatchUpdate"}}
+// Batch update request
+message BatchUpdate{{.ServiceName}}Request {
+  repeated {{.ServiceName}} items = 1;
+}
+
+// Batch update response
+message BatchUpdate{{.ServiceName}}Response {
+  repeated {{.ServiceName}} items = 1;
+}
+{{end}}
+{{- if $api.Has "BatchDelete"}}
+// Batch delete request
+message BatchDelete{{.ServiceName}}Request {
+  repeated {{(index .Key 0).Type}} ids = 1;
+}
+{{end}}
+{{- if $api.Has "Upsert"}}
+// Upsert request
+message Upsert{{.ServiceName}}Request {
+  {{.ServiceName}} {{.ServiceField}} = 1;
+}
+{{end}}
+{{- range $api.Custom}}
+// {{.Name}} request
+message {{.Name}}{{$svc.ServiceName}}Request {
+{{- range $i, $k := $svc.Key}}
+  {{$k.Type}} {{$k.Name}} = {{idx $i}};
+{{- end}}
+}
+{{end}}
+// {{.ServiceName}} service definition
+service {{.ServiceName}}Service {
+{{- if $api.Has "Create"}}
+  // Create a new {{.ServiceNameLower}}
+  rpc Create(Create{{.ServiceName}}Request) returns ({{.ServiceName}}) {
+    option (google.api.http) = {
+      post: "/api/v1/{{.ServiceNamePlural}}"
+      body: "{{.ServiceField}}"
+    };
+  }
+{{end}}
+{{- if $api.Has "Get"}}
+  // Get {{.ServiceNameLower}} by ID
+  rpc Get(Get{{.ServiceName}}Request) returns ({{.ServiceName}}) {
+    option (google.api.http) = {
+      get: "/api/v1/{{.ServiceNamePlural}}/{{.KeyPath}}"
+    };
+  }
+{{end}}
+{{- if $api.Has "List"}}
+  // List all {{.ServiceNamePlural}}
+  rpc List(List{{.ServiceName}}Request) returns (List{{.ServiceName}}Response) {
+    option (google.api.http) = {
+      get: "/api/v1/{{.ServiceNamePlural}}"
+    };
+  }
+{{end}}
+{{- if $api.Has "Update"}}
+  // Update {{.ServiceNameLower}}
+  rpc Update(Update{{.ServiceName}}Request) returns ({{.ServiceName}}) {
+    option (google.api.http) = {
+      put: "/api/v1/{{.ServiceNamePlural}}/{{.KeyPath}}"
+      body: "{{.ServiceField}}"
+    };
+  }
+{{end}}
+{{- if $api.Has "Delete"}}
+  // Delete {{.ServiceNameLower}}
+  rpc Delete(Delete{{.ServiceName}}Request) returns (EmptyResponse) {
+    option (google.api.http) = {
+      delete: "/api/v1/{{.ServiceNamePlural}}/{{.KeyPath}}"
+    };
+  }
+{{end}}
+{{- if $api.Has "BatchCreate"}}
+  // Create several {{.ServiceNamePlural}} at once
+  rpc BatchCreate(BatchCreate{{.ServiceName}}Request) returns (BatchCreate{{.ServiceName}}Response) {
+    option (google.api.http) = {
+      post: "/api/v1/{{.ServiceNamePlural}}:batchCreate"
+      body: "*"
+    };
+  }
+{{end}}
+{{- if $api.Has "BatchGet"}}
+  // Get several {{.ServiceNamePlural}} by ID
+  rpc BatchGet(BatchGet{{.ServiceName}}Request) returns (BatchGet{{.ServiceName}}Response) {
+    option (google.api.http) = {
+      get: "/api/v1/{{.ServiceNamePlural}}:batchGet"
+    };
+  }
+{{end}}
+{{- if $api.Has "BatchUpdate"}}
+  // Update several {{.ServiceNamePlural}} at once
+  rpc BatchUpdate(BatchUpdate{{.ServiceName}}Request) returns (BatchUpdate{{.ServiceName}}Response) {
+    option (google.api.http) = {
+      post: "/api/v1/{{.ServiceNamePlural}}:batchUpdate"
+      body: "*"
+    };
+  }
+{{end}}
+{{- if $api.Has "BatchDelete"}}
+  // Delete several {{.ServiceNamePlural}} by ID
+  rpc BatchDelete(BatchDelete{{.ServiceName}}Request) returns (EmptyResponse) {
+    option (google.api.http) = {
+      post: "/api/v1/{{.ServiceNamePlural}}:batchDelete"
+      body: "*"
+    };
+  }
+{{end}}
+{{- if $api.Has "Upsert"}}
+  // Create or replace {{.ServiceNameLower}}
+  rpc Upsert(Upsert{{.ServiceName}}Request) returns ({{.ServiceName}}) {
+    option (google.api.http) = {
+      post: "/api/v1/{{.ServiceNamePlural}}:upsert"
+      body: "{{.ServiceField}}"
+    };
+  }
+{{end}}
+{{- range $api.Custom}}
+  // {{.Name}} {{$svc.ServiceNameLower}}
+  rpc {{.Name}}({{.Name}}{{$svc.ServiceName}}Request) returns ({{$svc.ServiceName}}) {
+    option (google.api.http) = {
+      post: "/api/v1/{{$svc.ServiceNamePlural}}/{{$svc.KeyPath}}:{{.Verb}}"
+      body: "*"
+    };
+  }
+{{end}}
+{{- range .Extra}}
+{{.}}{{end -}}
+}
+{{end}}
+{{- range .UserServices}}
+{{.}}{{end}}`
+
+// FileData - данные выходного proto файла
+type FileData struct {
+	Syntax       string
+	ProtoPackage string
+	GoPackage    string
+	Imports      []string
+	FileOptions  []string
+	// Definitions - типы исходного файла, напечатанные из дескрипторов
+	Definitions string
+	// Services - CRUD сервисы для сущностей файла
+	Services []ServiceData
+	// UserServices - сервисы исходного файла, не связанные с сущностями
+	UserServices []string
+}
+
+type ServiceData struct {
+	ServiceName       string
+	ServiceNameLower  string
+	ServiceNamePlural string
+	// ServiceField - имя поля с сущностью в запросах (snake_case)
+	ServiceField string
+	// API - стандартные и пользовательские методы сервиса
+	API protoload.API
+	// Extra - методы из сервиса <Entity>Service исходного файла
+	Extra []string
+	// Key - поля первичного ключа, KeyPath - их шаблон в HTTP пути
+	Key     []KeyField
+	KeyPath string
+}
+
+// KeyField - поле первичного ключа в запросах
+type KeyField struct {
+	Name string
+	Type string
+}
+
+// NewProtoGen создаёт генератор proto файлов для Go модуля modulePath.
+// Пустой protoPackage выводится из пути модуля.
+func NewProtoGen(sourceDir, outputDir, modulePath, protoPackage string) *ProtoGen {
+	if protoPackage == "" {
+		protoPackage = modpath.ProtoPackage(modulePath)
+	}
+	return &ProtoGen{
+		sourceDir:    sourceDir,
+		outputDir:    outputDir,
+		protoPackage: protoPackage,
+		goPackage:    modpath.ProtoImport(modulePath),
+		logger:       slog.Default(),
+	}
+}
+
+// SetImportPaths задаёт дополнительные директории для импортов
+func (g *ProtoGen) SetImportPaths(paths []string) {
+	g.importPaths = paths
+}
+
+// SetLogger задаёт журнал для предупреждений
+func (g *ProtoGen) SetLogger(logger *slog.Logger) {
+	g.logger = logger
+}
+
+// SetOverrides задаёт параметры сообщений из файла настроек
+func (g *ProtoGen) SetOverrides(overrides map[string]protoload.Override) {
+	g.overrides = overrides
+}
+
+// SetLegacyEntities включает прежнее правило выбора сущностей без
+// (appgen.entity); должно совпадать с настройкой генератора кода
+func (g *ProtoGen) SetLegacyEntities(legacy bool) {
+	g.legacyEntities = legacy
+}
+
+// Generate записывает common.proto и выходные proto для всех файлов
+// исходной директории
+func (g *ProtoGen) Generate() error {
+	// Create output directory
+	if err := os.MkdirAll(g.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Generate common.proto
+	if err := g.generateCommonProto(); err != nil {
+		return fmt.Errorf("failed to generate common.proto: %w", err)
+	}
+
+	// Process all proto files in source directory
+	files, err := filepath.Glob(filepath.Join(g.sourceDir, "*.proto"))
+	if err != nil {
+		return fmt.Errorf("failed to list proto files: %w", err)
+	}
+
+	for _, file := range files {
+		if err := g.generateServiceProto(file); err != nil {
+			return fmt.Errorf("failed to generate service proto for %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+func (g *ProtoGen) generateCommonProto() error {
+	tmpl, err := template.New("common").Parse(commonProtoTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	data := FileData{ProtoPackage: g.protoPackage, GoPackage: g.goPackage}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	outPath := filepath.Join(g.outputDir, "common.proto")
+	return os.WriteFile(outPath, buf.Bytes(), 0644)
+}
+
+func (g *ProtoGen) generateServiceProto(sourcePath string) error {
+	relPath, err := filepath.Rel(g.sourceDir, sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve source path: %w", err)
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	// Компилируем исходный файл, импорты ищутся относительно source директории
+	importPaths := append([]string{g.sourceDir}, g.importPaths...)
+	set, err := protoload.Load(context.Background(), []string{relPath}, importPaths)
+	if err != nil {
+		return fmt.Errorf("failed to compile source file: %w", err)
+	}
+	set.SetOverrides(g.overrides)
+	set.SetLegacyEntities(g.legacyEntities)
+	file, err := set.File(relPath)
+	if err != nil {
+		return err
+	}
+
+	entities := set.Entities(file)
+	if len(entities) == 0 && !g.legacyEntities {
+		g.logger.Warn("no messages marked with (appgen.entity), the file gets no CRUD service", "file", relPath)
+	}
+
+	if file.Syntax() == protoreflect.Editions {
+		return fmt.Errorf("editions are not supported, use proto2 or proto3 syntax")
+	}
+
+	p := newPrinter(set, file)
+	data := FileData{
+		Syntax:       file.Syntax().String(),
+		ProtoPackage: g.protoPackage,
+		GoPackage:    g.goPackage,
+		Imports:      serviceImports(file),
+		FileOptions:  p.fileOptions(),
+		Definitions:  p.definitions(),
+	}
+
+	for _, message := range entities {
+		name := string(message.Name())
+		resource := set.MessageOptions(message).Resource
+		if resource == "" {
+			resource = inflect.ResourceName(name)
+		}
+
+		api, err := set.API(message)
+		if err != nil {
+			return err
+		}
+		key, err := set.PrimaryKey(message)
+		if err != nil {
+			return err
+		}
+
+		var keyFields []KeyField
+		var keyPath []string
+		for _, fd := range key.Fields {
+			keyFields = append(keyFields, KeyField{Name: string(fd.Name()), Type: fd.Kind().String()})
+			keyPath = append(keyPath, "{"+string(fd.Name())+"}")
+		}
+
+		data.Services = append(data.Services, ServiceData{
+			ServiceName:       name,
+			ServiceNameLower:  strcase.ToDelimited(name, ' '),
+			ServiceNamePlural: resource,
+			ServiceField:      strcase.ToSnake(name),
+			API:               api,
+			Key:               keyFields,
+			KeyPath:           strings.Join(keyPath, "/"),
+		})
+	}
+
+	if err := g.mergeServices(set, file, &data); err != nil {
+		return err
+	}
+
+	// Создаем шаблон с нашими вспомогательными функциями
+	tmpl := template.New("service")
+	tmpl = tmpl.Funcs(template.FuncMap{
+		"toLower": strings.ToLower,
+		"idx":     func(i int) int { return i + 1 },
+	})
+
+	// Парсим шаблон
+	tmpl, err = tmpl.Parse(serviceProtoTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	outPath := filepath.Join(g.outputDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	outFile, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := tmpl.Execute(outFile, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return nil
+}
+
+// mergeServices переносит сервисы исходного файла в выходной. Методы
+// сервиса <Entity>Service добавляются к сгенерированному CRUD сервису,
+// остальные сервисы печатаются как есть.
+func (g *ProtoGen) mergeServices(set *protoload.Set, file protoreflect.FileDescriptor, data *FileData) error {
+	byName := make(map[string]*ServiceData, len(data.Services))
+	for i := range data.Services {
+		byName[data.Services[i].ServiceName+"Service"] = &data.Services[i]
+	}
+
+	services := file.Services()
+	for i := 0; i < services.Len(); i++ {
+		sd := services.Get(i)
+
+		target, ok := byName[string(sd.Name())]
+		if !ok {
+			p := newPrinter(set, file)
+			p.service(sd)
+			data.UserServices = append(data.UserServices, p.String())
+			continue
+		}
+
+		methods := sd.Methods()
+		for j := 0; j < methods.Len(); j++ {
+			md := methods.Get(j)
+			if target.generates(string(md.Name())) {
+				g.logger.Warn("method is generated from (appgen.api), its declaration is ignored",
+					"method", md.FullName(), "file", file.Path())
+				continue
+			}
+
+			p := newPrinter(set, file)
+			p.method(md, "  ")
+			target.Extra = append(target.Extra, p.String())
+		}
+	}
+
+	return nil
+}
+
+// generates сообщает, генерируется ли метод с таким именем из (appgen.api)
+func (s *ServiceData) generates(name string) bool {
+	if s.API.Has(protoload.Method(name)) {
+		return true
+	}
+	for _, m := range s.API.Custom {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceImports возвращает импорты сервисного proto: аннотации HTTP,
+// common.proto и импорты исходного файла, кроме параметров appgen
+func serviceImports(file protoreflect.FileDescriptor) []string {
+	imports := []string{"google/api/annotations.proto", "common.proto"}
+	seen := map[string]bool{protoload.OptionsFile: true}
+	for _, imp := range imports {
+		seen[imp] = true
+	}
+
+	fileImports := file.Imports()
+	for i := 0; i < fileImports.Len(); i++ {
+		path := fileImports.Get(i).Path()
+		if !seen[path] {
+			seen[path] = true
+			imports = append(imports, path)
+		}
+	}
+	return imports
+}
@@ -0,0 +1,166 @@
+package protoload
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Method - стандартный метод API сущности, имя совпадает с именем RPC
+type Method string
+
+const (
+	MethodCreate      Method = "Create"
+	MethodGet         Method = "Get"
+	MethodList        Method = "List"
+	MethodUpdate      Method = "Update"
+	MethodDelete      Method = "Delete"
+	MethodBatchCreate Method = "BatchCreate"
+	MethodBatchGet    Method = "BatchGet"
+	MethodBatchUpdate Method = "BatchUpdate"
+	MethodBatchDelete Method = "BatchDelete"
+	MethodUpsert      Method = "Upsert"
+)
+
+// AllMethods - стандартные методы в порядке их вывода в сервисе
+var AllMethods = []Method{
+	MethodCreate, MethodGet, MethodList, MethodUpdate, MethodDelete,
+	MethodBatchCreate, MethodBatchGet, MethodBatchUpdate, MethodBatchDelete,
+	MethodUpsert,
+}
+
+// DefaultMethods генерируются, если (appgen.api) не задана
+var DefaultMethods = []Method{MethodCreate, MethodGet, MethodList, MethodUpdate, MethodDelete}
+
+// API - набор RPC сущности, (appgen.api)
+type API struct {
+	// Methods - стандартные методы в порядке AllMethods
+	Methods []Method
+	// Custom - пользовательские методы AIP-136 в порядке объявления
+	Custom []CustomMethod
+}
+
+// CustomMethod - пользовательский метод над одним ресурсом
+type CustomMethod struct {
+	// Name - имя RPC (Activate, MarkPaid)
+	Name string
+	// Verb - глагол в пути после двоеточия (activate, markPaid)
+	Verb string
+}
+
+// Has сообщает, генерируется ли стандартный метод
+func (a API) Has(method Method) bool {
+	for _, m := range a.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseMethod разбирает имя стандартного метода в виде значения
+// appgen.Method (BATCH_GET) или имени RPC (BatchGet)
+func ParseMethod(name string) (Method, error) {
+	for _, m := range []Method{Method(name), methodFromEnum(name)} {
+		for _, known := range AllMethods {
+			if m == known {
+				return m, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown method %q", name)
+}
+
+// methodFromEnum переводит значение appgen.Method в имя RPC: BATCH_GET -> BatchGet
+func methodFromEnum(name string) Method {
+	return Method(strcase.ToCamel(strings.ToLower(name)))
+}
+
+// parseAPI читает значение (appgen.api). Если опция не задана,
+// возвращается набор методов по умолчанию.
+func parseAPI(v protoreflect.Value, ok bool) (API, error) {
+	if !ok {
+		return API{Methods: DefaultMethods}, nil
+	}
+
+	msg := v.Message()
+	fields := msg.Descriptor().Fields()
+
+	enabled := make(map[Method]bool)
+	methods := msg.Get(fields.ByName("methods")).List()
+	methodEnum := fields.ByName("methods").Enum()
+	for i := 0; i < methods.Len(); i++ {
+		value := methodEnum.Values().ByNumber(methods.Get(i).Enum())
+		if value == nil || value.Number() == 0 {
+			return API{}, fmt.Errorf("unknown method %d", methods.Get(i).Enum())
+		}
+		enabled[methodFromEnum(string(value.Name()))] = true
+	}
+
+	var api API
+	for _, m := range AllMethods {
+		if enabled[m] {
+			api.Methods = append(api.Methods, m)
+		}
+	}
+
+	seen := make(map[string]bool)
+	custom := msg.Get(fields.ByName("custom")).List()
+	for i := 0; i < custom.Len(); i++ {
+		cm := custom.Get(i).Message()
+		name := cm.Get(cm.Descriptor().Fields().ByName("name")).String()
+		if name == "" {
+			return API{}, fmt.Errorf("custom method %d has no name", i+1)
+		}
+
+		method := CustomMethod{
+			Name: strcase.ToCamel(name),
+			Verb: strcase.ToLowerCamel(name),
+		}
+		for _, m := range AllMethods {
+			if string(m) == method.Name {
+				return API{}, fmt.Errorf("custom method %q clashes with standard method %s", name, m)
+			}
+		}
+		if seen[method.Name] {
+			return API{}, fmt.Errorf("custom method %q is declared twice", name)
+		}
+		seen[method.Name] = true
+		api.Custom = append(api.Custom, method)
+	}
+
+	return api, nil
+}
+
+// API читает набор RPC сущности из опции (appgen.api)
+func (s *Set) API(md protoreflect.MessageDescriptor) (API, error) {
+	v, ok := s.extension(s.Options(md.Options()), "appgen.api")
+	api, err := parseAPI(v, ok)
+	if err != nil {
+		return API{}, fmt.Errorf("%s: (appgen.api): %w", md.FullName(), err)
+	}
+	if o, ok := s.override(md); ok && o.Methods != nil {
+		api.Methods = nil
+		for _, m := range AllMethods {
+			for _, enabled := range o.Methods {
+				if m == enabled {
+					api.Methods = append(api.Methods, m)
+					break
+				}
+			}
+		}
+	}
+
+	// Пакетные методы принимают список значений ключа, составной ключ
+	// так передать нельзя
+	if key, err := s.primaryKey(md); err == nil && key.Composite() {
+		for _, m := range []Method{MethodBatchGet, MethodBatchDelete} {
+			if api.Has(m) {
+				return API{}, fmt.Errorf("%s: (appgen.api): %s is not supported with a composite primary key", md.FullName(), m)
+			}
+		}
+	}
+	return api, nil
+}
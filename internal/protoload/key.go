@@ -0,0 +1,125 @@
+package protoload
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// KeyStrategy - способ получения значения первичного ключа
+type KeyStrategy string
+
+const (
+	// KeyDBDefault - значение генерирует база данных
+	KeyDBDefault KeyStrategy = "db"
+	// KeyUUIDv7 - приложение генерирует UUIDv7 при создании
+	KeyUUIDv7 KeyStrategy = "uuidv7"
+	// KeyULID - приложение генерирует ULID при создании
+	KeyULID KeyStrategy = "ulid"
+	// KeyNatural - значение передаёт клиент
+	KeyNatural KeyStrategy = "natural"
+)
+
+// defaultKeyField - ключ сущности, если (appgen.primary_key) не задана
+const defaultKeyField = "id"
+
+// PrimaryKey - первичный ключ сущности, (appgen.primary_key)
+type PrimaryKey struct {
+	// Fields - поля ключа в порядке объявления в опции
+	Fields   []protoreflect.FieldDescriptor
+	Strategy KeyStrategy
+}
+
+// Composite сообщает, состоит ли ключ из нескольких полей
+func (k PrimaryKey) Composite() bool {
+	return len(k.Fields) > 1
+}
+
+// KeyFieldError - поле ключа отсутствует в сообщении или не подходит для
+// ключа по типу
+type KeyFieldError struct {
+	Field string
+	// Missing - поля нет в сообщении
+	Missing bool
+}
+
+func (e *KeyFieldError) Error() string {
+	if e.Missing {
+		return fmt.Sprintf("field %q not found", e.Field)
+	}
+	return fmt.Sprintf("key field %q must be a singular int64 or string", e.Field)
+}
+
+var keyStrategies = map[protoreflect.Name]KeyStrategy{
+	"DB_DEFAULT": KeyDBDefault,
+	"UUID_V7":    KeyUUIDv7,
+	"ULID":       KeyULID,
+	"NATURAL":    KeyNatural,
+}
+
+// PrimaryKey читает первичный ключ сущности и проверяет, что поля ключа
+// существуют и подходят выбранной стратегии
+func (s *Set) PrimaryKey(md protoreflect.MessageDescriptor) (PrimaryKey, error) {
+	key, err := s.primaryKey(md)
+	if err != nil {
+		return PrimaryKey{}, fmt.Errorf("%s: (appgen.primary_key): %w", md.FullName(), err)
+	}
+	return key, nil
+}
+
+func (s *Set) primaryKey(md protoreflect.MessageDescriptor) (PrimaryKey, error) {
+	names := []string{defaultKeyField}
+	var strategy KeyStrategy
+
+	if v, ok := s.extension(s.Options(md.Options()), "appgen.primary_key"); ok {
+		msg := v.Message()
+		fields := msg.Descriptor().Fields()
+
+		list := msg.Get(fields.ByName("fields")).List()
+		if list.Len() > 0 {
+			names = names[:0]
+			for i := 0; i < list.Len(); i++ {
+				names = append(names, list.Get(i).String())
+			}
+		}
+
+		strategyField := fields.ByName("strategy")
+		if value := strategyField.Enum().Values().ByNumber(msg.Get(strategyField).Enum()); value != nil {
+			strategy = keyStrategies[value.Name()]
+		}
+	}
+
+	var key PrimaryKey
+	seen := make(map[string]bool)
+	for _, name := range names {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return PrimaryKey{}, &KeyFieldError{Field: name, Missing: true}
+		}
+		if seen[name] {
+			return PrimaryKey{}, fmt.Errorf("field %q is listed twice", name)
+		}
+		seen[name] = true
+		if fd.Cardinality() == protoreflect.Repeated || (fd.Kind() != protoreflect.Int64Kind && fd.Kind() != protoreflect.StringKind) {
+			return PrimaryKey{}, &KeyFieldError{Field: name}
+		}
+		key.Fields = append(key.Fields, fd)
+	}
+
+	if strategy == "" {
+		strategy = KeyNatural
+		if !key.Composite() && names[0] == defaultKeyField {
+			strategy = KeyDBDefault
+		}
+	}
+	key.Strategy = strategy
+
+	switch {
+	case key.Composite() && strategy != KeyNatural:
+		return PrimaryKey{}, fmt.Errorf("composite keys only support the NATURAL strategy")
+	case (strategy == KeyUUIDv7 || strategy == KeyULID) && key.Fields[0].Kind() != protoreflect.StringKind:
+		return PrimaryKey{}, fmt.Errorf("strategy %s requires a string key field", strategy)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,167 @@
+package protoload
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// MessageOptions - параметры appgen, заданные в опциях сообщения
+type MessageOptions struct {
+	// Table - имя таблицы, (appgen.table)
+	Table string
+	// Resource - имя REST ресурса, (appgen.resource)
+	Resource string
+	// Entity - сообщение является сущностью со своим CRUD сервисом, (appgen.entity)
+	Entity bool
+}
+
+// MessageOptions читает параметры appgen из опций сообщения
+func (s *Set) MessageOptions(md protoreflect.MessageDescriptor) MessageOptions {
+	opts := s.Options(md.Options())
+	result := MessageOptions{
+		Table:    s.stringOption(opts, "appgen.table"),
+		Resource: s.stringOption(opts, "appgen.resource"),
+		Entity:   s.boolOption(opts, "appgen.entity"),
+	}
+
+	if o, ok := s.override(md); ok {
+		if o.Table != "" {
+			result.Table = o.Table
+		}
+		if o.Resource != "" {
+			result.Resource = o.Resource
+		}
+		if o.Entity != nil {
+			result.Entity = *o.Entity
+		}
+	}
+	return result
+}
+
+// FieldOptions - параметры appgen, заданные в опции поля (appgen.field)
+type FieldOptions struct {
+	// Required - поле обязательно: колонка NOT NULL, нулевое значение отклоняется
+	Required bool
+	// Ref - сущность, на которую ссылается поле
+	Ref string
+}
+
+// FieldOptions читает параметры appgen из опций поля
+func (s *Set) FieldOptions(fd protoreflect.FieldDescriptor) FieldOptions {
+	var result FieldOptions
+	if v, ok := s.extension(s.Options(fd.Options()), "appgen.field"); ok {
+		msg := v.Message()
+		result.Required = msg.Get(msg.Descriptor().Fields().ByName("required")).Bool()
+		result.Ref = msg.Get(msg.Descriptor().Fields().ByName("ref")).String()
+	}
+	return result
+}
+
+// SetLegacyEntities включает прежнее правило выбора сущностей: каждое
+// сообщение верхнего уровня, кроме *Request и *Response
+func (s *Set) SetLegacyEntities(legacy bool) {
+	s.legacyEntities = legacy
+}
+
+// Entities возвращает сущности файла - сообщения верхнего уровня,
+// отмеченные (appgen.entity), в порядке объявления. С SetLegacyEntities
+// отметка не нужна, пропускаются только запросы и ответы.
+func (s *Set) Entities(file protoreflect.FileDescriptor) []protoreflect.MessageDescriptor {
+	var entities []protoreflect.MessageDescriptor
+	messages := file.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if s.legacyEntities {
+			name := string(md.Name())
+			if strings.HasSuffix(name, "Request") || strings.HasSuffix(name, "Response") {
+				continue
+			}
+		} else if !s.MessageOptions(md).Entity {
+			continue
+		}
+		entities = append(entities, md)
+	}
+	return entities
+}
+
+// IsEntity сообщает, является ли сообщение сущностью своего файла
+func (s *Set) IsEntity(md protoreflect.MessageDescriptor) bool {
+	file, ok := md.Parent().(protoreflect.FileDescriptor)
+	if !ok {
+		return false
+	}
+	for _, entity := range s.Entities(file) {
+		if entity.FullName() == md.FullName() {
+			return true
+		}
+	}
+	return false
+}
+
+// Options разбирает опции дескриптора заново с учётом расширений из
+// скомпилированных файлов. Компилятор хранит незнакомые Go расширения как
+// неизвестные поля, после разбора они доступны через protoreflect.
+func (s *Set) Options(opts proto.Message) protoreflect.Message {
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return nil
+	}
+
+	data, err := proto.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+
+	msg := dynamicpb.NewMessage(opts.ProtoReflect().Descriptor())
+	if err := (proto.UnmarshalOptions{Resolver: s.extensions}).Unmarshal(data, msg); err != nil {
+		return nil
+	}
+	return msg
+}
+
+func (s *Set) extension(opts protoreflect.Message, name protoreflect.FullName) (protoreflect.Value, bool) {
+	if opts == nil {
+		return protoreflect.Value{}, false
+	}
+
+	xt, err := s.extensions.FindExtensionByName(name)
+	if err != nil {
+		return protoreflect.Value{}, false
+	}
+
+	fd := xt.TypeDescriptor()
+	if !opts.Has(fd) {
+		return protoreflect.Value{}, false
+	}
+	return opts.Get(fd), true
+}
+
+func (s *Set) stringOption(opts protoreflect.Message, name protoreflect.FullName) string {
+	v, ok := s.extension(opts, name)
+	if !ok {
+		return ""
+	}
+	return v.String()
+}
+
+func (s *Set) boolOption(opts protoreflect.Message, name protoreflect.FullName) bool {
+	v, ok := s.extension(opts, name)
+	if !ok {
+		return false
+	}
+	return v.Bool()
+}
+
+// IsAppgenOption сообщает, является ли поле опций расширением appgen.
+// Такие опции нужны только генератору и не переносятся в выходные proto.
+func IsAppgenOption(fd protoreflect.FieldDescriptor) bool {
+	return fd.IsExtension() && fd.ParentFile().Path() == OptionsFile
+}
+
+// HasHTTPRule сообщает, задана ли у метода опция (google.api.http)
+func (s *Set) HasHTTPRule(md protoreflect.MethodDescriptor) bool {
+	_, ok := s.extension(s.Options(md.Options()), "google.api.http")
+	return ok
+}
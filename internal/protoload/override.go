@@ -0,0 +1,28 @@
+package protoload
+
+import "google.golang.org/protobuf/reflect/protoreflect"
+
+// Override - параметры сообщения из конфигурации проекта. Заданные значения
+// перекрывают опции appgen из proto файла.
+type Override struct {
+	Table    string
+	Resource string
+	// Entity - nil, если конфигурация не меняет (appgen.entity)
+	Entity *bool
+	// Methods - стандартные методы вместо methods из (appgen.api), nil - не менять
+	Methods []Method
+}
+
+// SetOverrides задаёт параметры сообщений. Ключ - полное (shop.Courier)
+// или короткое (Courier) имя сообщения, полное имя имеет приоритет.
+func (s *Set) SetOverrides(overrides map[string]Override) {
+	s.overrides = overrides
+}
+
+func (s *Set) override(md protoreflect.MessageDescriptor) (Override, bool) {
+	if o, ok := s.overrides[string(md.FullName())]; ok {
+		return o, true
+	}
+	o, ok := s.overrides[string(md.Name())]
+	return o, ok
+}
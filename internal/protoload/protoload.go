@@ -0,0 +1,161 @@
+// Package protoload компилирует proto файлы в дескрипторы без внешнего protoc
+// и читает из них параметры appgen (appgen/options.proto)
+package protoload
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/linker"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// Регистрируем google/api/*.proto, чтобы их можно было импортировать без include path
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+)
+
+// OptionsFile - путь, по которому proto файлы импортируют параметры appgen
+const OptionsFile = "appgen/options.proto"
+
+//go:embed appgen/options.proto
+var optionsFS embed.FS
+
+// OptionsSource возвращает исходный текст appgen/options.proto
+func OptionsSource() []byte {
+	data, _ := optionsFS.ReadFile(OptionsFile)
+	return data
+}
+
+// Set - скомпилированные proto файлы вместе с расширениями appgen
+type Set struct {
+	files      linker.Files
+	extensions *protoregistry.Types
+	// overrides - параметры сообщений из конфигурации проекта
+	overrides map[string]Override
+	// legacyEntities - сущностями считаются все сообщения верхнего уровня,
+	// кроме *Request и *Response, независимо от (appgen.entity)
+	legacyEntities bool
+}
+
+// Load компилирует proto файлы. Пути файлов задаются относительно одной из
+// importPaths; если importPaths пуст, пути используются как есть.
+// appgen/options.proto, google/api/*.proto и стандартные google/protobuf/*.proto
+// доступны всегда.
+func Load(ctx context.Context, files []string, importPaths []string) (*Set, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(protocompile.CompositeResolver{
+			&protocompile.SourceResolver{
+				ImportPaths: importPaths,
+				Accessor:    accessor,
+			},
+			protocompile.ResolverFunc(findRegisteredFile),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+
+	compiled, err := compiler.Compile(ctx, append(append([]string{}, files...), OptionsFile)...)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{
+		files:      compiled[:len(files)],
+		extensions: new(protoregistry.Types),
+	}
+
+	// Регистрируем расширения из всех файлов и их импортов, чтобы читать
+	// пользовательские опции дескрипторов, в том числе опции appgen
+	seen := make(map[string]bool)
+	for _, f := range compiled {
+		if err := set.registerExtensions(f, seen); err != nil {
+			return nil, err
+		}
+	}
+
+	return set, nil
+}
+
+func (s *Set) registerExtensions(file protoreflect.FileDescriptor, seen map[string]bool) error {
+	if seen[file.Path()] {
+		return nil
+	}
+	seen[file.Path()] = true
+
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		if err := s.registerExtensions(imports.Get(i).FileDescriptor, seen); err != nil {
+			return err
+		}
+	}
+
+	var register func(exts protoreflect.ExtensionDescriptors, messages protoreflect.MessageDescriptors) error
+	register = func(exts protoreflect.ExtensionDescriptors, messages protoreflect.MessageDescriptors) error {
+		for i := 0; i < exts.Len(); i++ {
+			xd := exts.Get(i)
+			if _, err := s.extensions.FindExtensionByName(xd.FullName()); err == nil {
+				continue
+			}
+			if err := s.extensions.RegisterExtension(dynamicpb.NewExtensionType(xd)); err != nil {
+				return fmt.Errorf("failed to register %s: %w", xd.FullName(), err)
+			}
+		}
+		for i := 0; i < messages.Len(); i++ {
+			md := messages.Get(i)
+			if err := register(md.Extensions(), md.Messages()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return register(file.Extensions(), file.Messages())
+}
+
+// Files возвращает скомпилированные файлы в порядке, в котором они были переданы в Load
+func (s *Set) Files() []protoreflect.FileDescriptor {
+	files := make([]protoreflect.FileDescriptor, len(s.files))
+	for i, f := range s.files {
+		files[i] = f
+	}
+	return files
+}
+
+// File возвращает скомпилированный файл по пути, переданному в Load
+func (s *Set) File(path string) (protoreflect.FileDescriptor, error) {
+	if f := s.files.FindFileByPath(path); f != nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("file %s was not compiled", path)
+}
+
+// accessor читает файлы с диска, а appgen/options.proto - из встроенной копии
+func accessor(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	// SourceResolver добавляет к пути include директорию, поэтому сравниваем по суффиксу
+	if slashed := filepath.ToSlash(filepath.Clean(path)); slashed == OptionsFile || strings.HasSuffix(slashed, "/"+OptionsFile) {
+		return io.NopCloser(bytes.NewReader(OptionsSource())), nil
+	}
+	return nil, err
+}
+
+// findRegisteredFile ищет файл среди дескрипторов, вкомпилированных в генератор
+func findRegisteredFile(path string) (protocompile.SearchResult, error) {
+	fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+	if err != nil {
+		return protocompile.SearchResult{}, err
+	}
+	return protocompile.SearchResult{Desc: fd}, nil
+}
@@ -0,0 +1,278 @@
+package scaffold
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+
+	"generator/internal/generator"
+	"generator/internal/inflect"
+	"generator/internal/protoload"
+)
+
+// Entity - новая сущность, для которой пишется proto файл
+type Entity struct {
+	Name string
+	// Package - proto пакет файла
+	Package string
+	// Fields - поля после ключа id
+	Fields []Field
+	// Sample - пример для нового проекта, с комментариями об опциях
+	Sample bool
+}
+
+// Field - поле новой сущности
+type Field struct {
+	Name string
+	// Type - тип поля в proto
+	Type     string
+	Required bool
+	// Ref - сущность, на которую ссылается поле, тип поля совпадает с её ключом
+	Ref string
+}
+
+// fieldTypes - типы полей, которые принимает ParseField, и их типы в proto
+var fieldTypes = map[string]string{
+	"string":    "string",
+	"int64":     "int64",
+	"int32":     "int32",
+	"double":    "double",
+	"float":     "float",
+	"bytes":     "bytes",
+	"bool":      "bool",
+	"timestamp": "google.protobuf.Timestamp",
+}
+
+// reservedFields - колонки, которые генератор добавляет сам
+var reservedFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// reservedNames - имена, которые в нижнем регистре совпали бы с ключевыми
+// словами Go, пакетами сгенерированного сервиса или их импортами
+var reservedNames = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+
+	"common": true, "errors": true, "interfaces": true, "main": true, "models": true,
+	"proto": true, "repository": true, "service": true, "tests": true, "types": true,
+
+	"codes": true, "context": true, "fmt": true, "godotenv": true, "grpc": true,
+	"http": true, "log": true, "net": true, "os": true, "pq": true, "reflection": true,
+	"runtime": true, "sq": true, "sqlx": true, "status": true, "time": true,
+}
+
+// reservedSuffixes - окончания имён сообщений, которые генератор создаёт сам
+var reservedSuffixes = []string{"Request", "Response", "Service"}
+
+var (
+	// После подчёркивания цифра не допускается: protoc-gen-go назвал бы
+	// поле line_2 Line_2, а модель - Line2
+	fieldNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z][a-z0-9]*)*$`)
+	refPattern       = regexp.MustCompile(`^ref\(([A-Za-z][A-Za-z0-9]*)\)$`)
+)
+
+// ParseField разбирает описание поля: name:type[:required], где type -
+// string, int64, int32, double, float, bool, bytes, timestamp или
+// ref(Entity). Поле-ссылка получает окончание _id, если его нет.
+func ParseField(spec string) (Field, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Field{}, fmt.Errorf("invalid field %q, use name:type[:required]", spec)
+	}
+
+	f := Field{Name: parts[0]}
+	if len(parts) == 3 {
+		if parts[2] != "required" {
+			return Field{}, fmt.Errorf("invalid field %q: unknown modifier %q, only required is supported", spec, parts[2])
+		}
+		f.Required = true
+	}
+
+	if m := refPattern.FindStringSubmatch(parts[1]); m != nil {
+		f.Ref = m[1]
+		if !strings.HasSuffix(f.Name, "_id") {
+			f.Name += "_id"
+		}
+	} else if protoType, ok := fieldTypes[parts[1]]; ok {
+		f.Type = protoType
+	} else {
+		return Field{}, fmt.Errorf("invalid field %q: unknown type %q, use one of %s or ref(Entity)",
+			spec, parts[1], strings.Join(typeNames(), ", "))
+	}
+
+	if !fieldNamePattern.MatchString(f.Name) {
+		return Field{}, fmt.Errorf("invalid field %q: name must be snake_case without digits after an underscore", spec)
+	}
+	if reservedFields[f.Name] {
+		return Field{}, fmt.Errorf("invalid field %q: %s is added by the generator", spec, f.Name)
+	}
+	// Генерируемый SQL не заключает имена в кавычки, так же проверяет lint
+	if generator.IsSQLReserved(f.Name) {
+		return Field{}, fmt.Errorf("invalid field %q: %s is a reserved SQL keyword", spec, f.Name)
+	}
+	return f, nil
+}
+
+func typeNames() []string {
+	return []string{"string", "int64", "int32", "double", "float", "bool", "bytes", "timestamp"}
+}
+
+// CheckEntity проверяет имя сущности: UpperCamelCase из одних букв, не
+// зарезервировано и не заканчивается на суффиксы сгенерированных сообщений.
+// Цифры не допускаются: protoc-gen-go и имена таблиц разбивают на них слова
+// иначе, чем генератор (Courier2 - поле Courier_2, таблица courier_2s).
+func CheckEntity(name string) error {
+	invalid := fmt.Errorf("invalid entity name %q, use an UpperCamelCase message name of letters only", name)
+	if name == "" || strcase.ToCamel(name) != name {
+		return invalid
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return invalid
+		}
+	}
+
+	if reservedNames[strings.ToLower(name)] {
+		return fmt.Errorf("entity name %q is reserved: it clashes with a Go keyword or a package of the generated service", name)
+	}
+	for _, suffix := range reservedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return fmt.Errorf("entity name %q is reserved: names ending in %s are generated", name, suffix)
+		}
+	}
+	if table := inflect.TableName(name); generator.IsSQLReserved(table) {
+		return fmt.Errorf("entity name %q is reserved: its table %s is a reserved SQL keyword", name, table)
+	}
+	return nil
+}
+
+// Check проверяет сущность против уже существующих proto файлов: имя не
+// должно совпадать с их сообщениями, ссылки должны вести на сущности с
+// ключом из одного поля или на саму сущность. Типы полей-ссылок берутся
+// из ключа.
+func (e *Entity) Check(set *protoload.Set) error {
+	if err := CheckEntity(e.Name); err != nil {
+		return err
+	}
+
+	for _, file := range set.Files() {
+		messages := file.Messages()
+		for i := 0; i < messages.Len(); i++ {
+			md := messages.Get(i)
+			// Имена в разном регистре дали бы одинаковые файлы и пакеты Go
+			if strings.EqualFold(string(md.Name()), e.Name) {
+				return fmt.Errorf("message %s already exists in %s", md.Name(), file.Path())
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(e.Fields))
+	for i := range e.Fields {
+		f := &e.Fields[i]
+		if seen[f.Name] {
+			return fmt.Errorf("field %s is declared twice", f.Name)
+		}
+		seen[f.Name] = true
+
+		if f.Ref == "" {
+			continue
+		}
+		// Ключ новой сущности - id, который генерирует база данных
+		if f.Ref == e.Name {
+			f.Type = "int64"
+			continue
+		}
+		keyType, err := refKeyType(set, f.Ref)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		f.Type = keyType
+	}
+	return nil
+}
+
+// Options возвращает содержимое опции (appgen.field) поля. Ссылка из поля
+// <entity>_id распознаётся генератором по имени, остальным нужна опция ref.
+func (f Field) Options() string {
+	var opts []string
+	if f.Ref != "" && f.Name != strcase.ToSnake(f.Ref)+"_id" {
+		opts = append(opts, fmt.Sprintf("ref: %q", f.Ref))
+	}
+	if f.Required {
+		opts = append(opts, "required: true")
+	}
+	return strings.Join(opts, ", ")
+}
+
+// refKeyType возвращает тип ключа сущности name
+func refKeyType(set *protoload.Set, name string) (string, error) {
+	for _, file := range set.Files() {
+		for _, md := range set.Entities(file) {
+			if string(md.Name()) != name {
+				continue
+			}
+			key, err := set.PrimaryKey(md)
+			if err != nil {
+				return "", err
+			}
+			if key.Composite() {
+				return "", fmt.Errorf("entity %s has a composite key and cannot be referenced", name)
+			}
+			return key.Fields[0].Kind().String(), nil
+		}
+	}
+	return "", fmt.Errorf("unknown entity %s", name)
+}
+
+// FileName возвращает имя proto файла сущности
+func (e *Entity) FileName() string {
+	return strcase.ToSnake(e.Name) + ".proto"
+}
+
+// Proto возвращает содержимое proto файла сущности
+func (e *Entity) Proto() ([]byte, error) {
+	return render("entity.proto.tmpl", entityData{Entity: e})
+}
+
+// entityData - данные шаблона entity.proto.tmpl
+type entityData struct {
+	*Entity
+}
+
+func (d entityData) Table() string {
+	return inflect.TableName(d.Name)
+}
+
+func (d entityData) UsesTimestamp() bool {
+	for _, f := range d.Fields {
+		if f.Type == fieldTypes["timestamp"] {
+			return true
+		}
+	}
+	return false
+}
+
+// PackageOf возвращает proto пакет, общий для всех файлов набора, или
+// пустую строку, если пакеты различаются
+func PackageOf(set *protoload.Set, files []string) string {
+	pkg := ""
+	for _, path := range files {
+		file, err := set.File(path)
+		if err != nil {
+			continue
+		}
+		if pkg != "" && string(file.Package()) != pkg {
+			return ""
+		}
+		pkg = string(file.Package())
+	}
+	return pkg
+}
@@ -0,0 +1,77 @@
+package scaffold
+
+import (
+	"testing"
+)
+
+func TestParseField(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Field
+		wantErr bool
+	}{
+		{spec: "name:string", want: Field{Name: "name", Type: "string"}},
+		{spec: "opened_at:timestamp", want: Field{Name: "opened_at", Type: "google.protobuf.Timestamp"}},
+		{spec: "rating:double:required", want: Field{Name: "rating", Type: "double", Required: true}},
+		{spec: "address2:string", want: Field{Name: "address2", Type: "string"}},
+		{spec: "region:ref(Region)", want: Field{Name: "region_id", Ref: "Region"}},
+		{spec: "region_id:ref(Region):required", want: Field{Name: "region_id", Ref: "Region", Required: true}},
+
+		{spec: "name", wantErr: true},
+		{spec: "name:string:required:extra", wantErr: true},
+		{spec: "name:string:optional", wantErr: true},
+		{spec: "name:uuid", wantErr: true},
+		{spec: "Name:string", wantErr: true},
+		{spec: "line_2:string", wantErr: true},
+		{spec: "id:int64", wantErr: true},
+		{spec: "created_at:timestamp", wantErr: true},
+		{spec: "order:string", wantErr: true},
+		{spec: "user:ref(User)", want: Field{Name: "user_id", Ref: "User"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseField(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseField() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseField() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseField() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckEntity(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "Courier"},
+		{name: "DeliveryZone"},
+		{name: "", wantErr: true},
+		{name: "courier", wantErr: true},
+		{name: "delivery_zone", wantErr: true},
+		{name: "Courier2", wantErr: true},
+		{name: "Courier-Zone", wantErr: true},
+		{name: "Map", wantErr: true},
+		{name: "Repository", wantErr: true},
+		{name: "TrackRequest", wantErr: true},
+		{name: "CourierService", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckEntity(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckEntity(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Package scaffold собирает файлы нового проекта appgen: настройки,
+// пример сущности и .gitignore.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"path/filepath"
+	"text/template"
+
+	"generator/internal/config"
+	"generator/internal/modpath"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// DefaultEntity - имя примера сущности по умолчанию
+const DefaultEntity = "Item"
+
+// Options - параметры нового проекта
+type Options struct {
+	// Config - настройки проекта, пути в них относительные
+	Config *config.Config
+	// Entity - имя сообщения примера сущности, пустое - без примера
+	Entity string
+}
+
+// File - файл проекта, путь относительно корня проекта
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// Files возвращает файлы нового проекта
+func Files(opts Options) ([]File, error) {
+	cfg := opts.Config
+	content, err := cfg.Render()
+	if err != nil {
+		return nil, err
+	}
+	files := []File{{Path: config.FileName, Content: content}}
+
+	if opts.Entity != "" {
+		pkg := cfg.Proto.Package
+		if pkg == "" {
+			pkg = modpath.ProtoPackage(cfg.Module)
+		}
+		entity := &Entity{
+			Name:    opts.Entity,
+			Package: pkg,
+			Fields: []Field{
+				{Name: "name", Type: "string", Required: true},
+				{Name: "description", Type: "string"},
+			},
+			Sample: true,
+		}
+		if err := CheckEntity(entity.Name); err != nil {
+			return nil, err
+		}
+		content, err := entity.Proto()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{
+			Path:    filepath.Join(cfg.Proto.Source, entity.FileName()),
+			Content: content,
+		})
+	}
+
+	// Резервные копии генератора лежат в <output>/.appgen/backup
+	backup := path.Join("/", filepath.ToSlash(cfg.Output.Dir), ".appgen", "backup") + "/"
+	content, err = render("gitignore.tmpl", map[string]string{"Backup": backup})
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, File{Path: ".gitignore", Content: content})
+
+	return files, nil
+}
+
+func render(name string, data interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		// number - номер поля proto после ключа id
+		"number": func(i int) int { return i + 2 },
+	}).ParseFS(templates, "templates/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,10 @@
+// Package templates содержит встроенные шаблоны генератора
+package templates
+
+import "embed"
+
+// FS - встроенные шаблоны. Шаблоны из директории переопределения
+// подменяют одноимённые файлы отсюда.
+//
+//go:embed *.tmpl
+var FS embed.FS
@@ -0,0 +1,347 @@
+// Package appgen - встраиваемый API генератора: разбирает proto файлы и
+// генерирует код сервиса в любую файловую систему, без запуска CLI.
+//
+//	mem := appgen.NewMemory()
+//	res, err := appgen.Generate(ctx, appgen.Options{
+//		Sources: []string{"proto"},
+//		Output:  mem,
+//	})
+//
+// Generate создаёт только код сервиса. Выходные proto и их Go код, как и
+// go mod tidy, остаются за командами appgen proto и appgen generate.
+package appgen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"generator/internal/config"
+	"generator/internal/generator"
+	"generator/internal/outfs"
+)
+
+// stateDir - служебная директория генератора в выходной файловой системе.
+// Хуки вызываются только для файлов проекта, не для неё.
+const stateDir = ".appgen"
+
+// FS - выходная файловая система: пути через "/" относительно корня проекта
+type FS = outfs.FS
+
+// Memory - файловая система в памяти
+type Memory = outfs.Memory
+
+// Zip - файловая система, которая при Close записывает файлы zip архивом
+type Zip = outfs.Zip
+
+// UpgradeReport - результат обновления проекта, см. Options.Upgrade
+type UpgradeReport = generator.UpgradeReport
+
+// Model - разобранная модель, которую получают плагины
+type Model = generator.Model
+
+// Plugin добавляет в проект свои файлы, см. Options.Plugins
+type Plugin = generator.Plugin
+
+// PluginRequest - модели и параметры проекта, которые получает плагин
+type PluginRequest = generator.PluginRequest
+
+// PluginFile - файл, который вернул плагин
+type PluginFile = generator.PluginFile
+
+// ExecPlugin - внешний плагин, который получает запрос в JSON на stdin
+type ExecPlugin = generator.ExecPlugin
+
+// PluginFunc превращает функцию в плагин с именем name
+func PluginFunc(name string, fn func(context.Context, *PluginRequest) ([]PluginFile, error)) Plugin {
+	return funcPlugin{name: name, fn: fn}
+}
+
+type funcPlugin struct {
+	name string
+	fn   func(context.Context, *PluginRequest) ([]PluginFile, error)
+}
+
+func (p funcPlugin) Name() string {
+	return p.name
+}
+
+func (p funcPlugin) Generate(ctx context.Context, req *PluginRequest) ([]PluginFile, error) {
+	return p.fn(ctx, req)
+}
+
+// OS возвращает файловую систему в директории dir
+func OS(dir string) FS {
+	return outfs.NewOS(dir)
+}
+
+// NewMemory возвращает пустую файловую систему в памяти
+func NewMemory() *Memory {
+	return outfs.NewMemory()
+}
+
+// NewZip возвращает файловую систему, которая при Close запишет архив в w
+func NewZip(w io.Writer) *Zip {
+	return outfs.NewZip(w)
+}
+
+// Options - настройки одного запуска генератора
+type Options struct {
+	// Config - путь к appgen.yaml. Пустой путь означает настройки по
+	// умолчанию. Поля ниже, если заданы, перекрывают настройки из файла.
+	Config string
+	// Sources - proto файлы и директории, из которых берутся все *.proto.
+	// По умолчанию proto.source из настроек.
+	Sources []string
+	// ImportPaths - дополнительные директории для импортов proto
+	ImportPaths []string
+	// Module - путь Go модуля генерируемого сервиса
+	Module string
+	// TemplatesDir - директория с шаблонами, переопределяющими встроенные
+	TemplatesDir string
+	// Output - куда писать проект, по умолчанию OS(output.dir) из настроек.
+	// Манифест прошлого запуска читается оттуда же.
+	Output FS
+	// Upgrade - слить новые шаблоны с отредактированными файлами, как
+	// appgen generate -upgrade. Отчёт возвращается в Result.Upgrade.
+	Upgrade bool
+	// DryRun - ничего не записывать в Output: результат описывает файлы,
+	// которые были бы записаны
+	DryRun bool
+	// Plugins - плагины в дополнение к плагинам из настроек
+	Plugins []Plugin
+	// Logger - журнал разбора и генерации, по умолчанию slog.Default()
+	Logger *slog.Logger
+	Hooks  Hooks
+}
+
+// Hooks - функции, которые генератор вызывает по ходу запуска. Ошибка из
+// хука прерывает генерацию и возвращается из Generate.
+type Hooks struct {
+	// BeforeWrite вызывается перед записью каждого файла проекта, который
+	// создаётся или меняется
+	BeforeWrite func(path string, data []byte) error
+	// AfterGenerate вызывается с результатом успешного запуска
+	AfterGenerate func(*Result) error
+}
+
+// Change - что произошло с файлом за запуск
+type Change string
+
+const (
+	Created   Change = "created"
+	Updated   Change = "updated"
+	Removed   Change = "removed"
+	Unchanged Change = "unchanged"
+)
+
+// Artifact - файл проекта
+type Artifact struct {
+	// Path - путь относительно корня проекта через /
+	Path string
+	// Template - шаблон, из которого получен файл
+	Template string
+	// Model - модель или сервис файла, для общих файлов пусто
+	Model string
+	// Mode - overwrite для файлов генератора, create-only для файлов,
+	// которые создаются один раз и дальше принадлежат пользователю
+	Mode string
+	// Checksum - sha256 содержимого после записи
+	Checksum string
+	Change   Change
+}
+
+// Result описывает все файлы проекта после запуска
+type Result struct {
+	// Artifacts - файлы проекта по алфавиту, включая удалённые запуском
+	Artifacts []Artifact
+	// Models - модели, файлы которых сгенерированы
+	Models []string
+	// Migrations - все миграции проекта в порядке применения
+	Migrations []string
+	// Upgrade - отчёт об обновлении, только при Options.Upgrade
+	Upgrade *UpgradeReport
+}
+
+// Changed возвращает созданные, изменённые и удалённые файлы
+func (r *Result) Changed() []Artifact {
+	var changed []Artifact
+	for _, a := range r.Artifacts {
+		if a.Change != Unchanged {
+			changed = append(changed, a)
+		}
+	}
+	return changed
+}
+
+// Generate генерирует проект по настройкам opts
+func Generate(ctx context.Context, opts Options) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cfg := config.Default()
+	if opts.Config != "" {
+		loaded, err := config.Load(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+	if opts.Module != "" {
+		cfg.Module = opts.Module
+	}
+	if opts.TemplatesDir != "" {
+		cfg.Output.Templates = opts.TemplatesDir
+	}
+
+	files, importPaths, err := sources(opts.Sources)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Sources) == 0 {
+		if files, err = cfg.ProtoFiles(); err != nil {
+			return nil, err
+		}
+		importPaths = []string{cfg.Proto.Source}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no proto files to generate from")
+	}
+
+	genOpts, err := cfg.GeneratorOptions()
+	if err != nil {
+		return nil, err
+	}
+	genOpts.ImportPaths = append(append(importPaths, opts.ImportPaths...), cfg.Proto.ImportPaths...)
+	genOpts.Logger = opts.Logger
+	genOpts.Plugins = append(genOpts.Plugins, opts.Plugins...)
+	g, err := generator.New(genOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create generator: %w", err)
+	}
+
+	out := opts.Output
+	if out == nil {
+		out = OS(cfg.Output.Dir)
+	}
+	if opts.DryRun {
+		out = outfs.NewDryRun(out)
+	}
+	dst := &hookFS{FS: out, ctx: ctx, beforeWrite: opts.Hooks.BeforeWrite}
+
+	var report *UpgradeReport
+	if opts.Upgrade {
+		report, err = g.Upgrade(ctx, files, dst)
+	} else {
+		err = g.Generate(ctx, files, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := newResult(g.Summary())
+	result.Upgrade = report
+	if opts.Hooks.AfterGenerate != nil {
+		if err := opts.Hooks.AfterGenerate(result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// sources раскрывает директории в proto файлы и возвращает директории
+// файлов для импортов
+func sources(paths []string) (files, dirs []string, err error) {
+	seen := make(map[string]bool)
+	addDir := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read source: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			addDir(filepath.Dir(p))
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.proto"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list proto files: %w", err)
+		}
+		files = append(files, matches...)
+		addDir(p)
+	}
+	return files, dirs, nil
+}
+
+// newResult собирает результат из итога генератора
+func newResult(s generator.Summary) *Result {
+	changes := make(map[string]generator.ChangeKind, len(s.Changes))
+	for _, c := range s.Changes {
+		changes[c.Path] = c.Kind
+	}
+
+	result := &Result{Models: s.Models, Migrations: s.Migrations}
+	for _, e := range s.Files {
+		a := Artifact{
+			Path:     e.Path,
+			Template: e.Template,
+			Model:    e.Model,
+			Mode:     e.Mode,
+			Checksum: e.Checksum,
+			Change:   Unchanged,
+		}
+		if kind, ok := changes[e.Path]; ok {
+			a.Change = Change(kind)
+		}
+		result.Artifacts = append(result.Artifacts, a)
+	}
+	for _, c := range s.Changes {
+		if c.Kind == generator.ChangeRemoved {
+			result.Artifacts = append(result.Artifacts, Artifact{Path: c.Path, Change: Removed})
+		}
+	}
+	sort.Slice(result.Artifacts, func(i, j int) bool {
+		return result.Artifacts[i].Path < result.Artifacts[j].Path
+	})
+	return result
+}
+
+// hookFS вызывает хуки перед записью файлов проекта и прекращает запись
+// после отмены контекста
+type hookFS struct {
+	FS
+	ctx         context.Context
+	beforeWrite func(path string, data []byte) error
+}
+
+func (h *hookFS) WriteFile(name string, data []byte) error {
+	if err := h.ctx.Err(); err != nil {
+		return err
+	}
+	if h.beforeWrite != nil && !strings.HasPrefix(name, stateDir+"/") {
+		if err := h.beforeWrite(name, data); err != nil {
+			return err
+		}
+	}
+	return h.FS.WriteFile(name, data)
+}
+
+func (h *hookFS) Remove(name string) error {
+	if err := h.ctx.Err(); err != nil {
+		return err
+	}
+	return h.FS.Remove(name)
+}
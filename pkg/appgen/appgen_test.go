@@ -0,0 +1,237 @@
+package appgen_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"generator/pkg/appgen"
+)
+
+const courierProto = `syntax = "proto3";
+package shop;
+import "appgen/options.proto";
+
+message Courier {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  string name = 2 [(appgen.field) = { required: true }];
+}
+`
+
+const regionProto = `syntax = "proto3";
+package shop;
+import "appgen/options.proto";
+
+message Region {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  string title = 2;
+}
+
+message Zone {
+  option (appgen.entity) = true;
+  int64 id = 1;
+  int64 region_id = 2;
+}
+`
+
+// writeProtos пишет proto файлы во временную директорию и возвращает её
+func writeProtos(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGenerateMemory(t *testing.T) {
+	tests := []struct {
+		name   string
+		protos map[string]string
+		module string
+		// wantModels - модели в порядке создания таблиц
+		wantModels []string
+		wantFiles  []string
+		// wantMigrations - окончания имён миграций в порядке применения
+		wantMigrations []string
+		// wantContent - подстроки файлов, пробелы сжаты до одного
+		wantContent map[string]string
+	}{
+		{
+			name:       "single entity",
+			protos:     map[string]string{"courier.proto": courierProto},
+			wantModels: []string{"Courier"},
+			wantFiles: []string{
+				"go.mod",
+				"cmd/app/main.go",
+				"internal/models/courier.go",
+				"internal/repository/courier/repository.go",
+				"internal/service/courier/service.go",
+				"internal/grpc/courier/server_gen.go",
+				".appgen/manifest.json",
+			},
+			wantMigrations: []string{"_create_updated_at_function.sql", "_create_courier.sql"},
+			wantContent: map[string]string{
+				"go.mod": "module app ",
+			},
+		},
+		{
+			name:       "referenced entity comes first",
+			protos:     map[string]string{"region.proto": regionProto},
+			module:     "example.com/shop",
+			wantModels: []string{"Region", "Zone"},
+			wantFiles: []string{
+				"internal/models/region.go",
+				"internal/models/zone.go",
+			},
+			wantMigrations: []string{"_create_updated_at_function.sql", "_create_region.sql", "_create_zone.sql"},
+			wantContent: map[string]string{
+				"go.mod":                  "module example.com/shop ",
+				"internal/models/zone.go": "RegionId *int64",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := appgen.NewMemory()
+			res, err := appgen.Generate(context.Background(), appgen.Options{
+				Sources: []string{writeProtos(t, tt.protos)},
+				Module:  tt.module,
+				Output:  mem,
+				Logger:  discard(),
+			})
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(res.Models, tt.wantModels) {
+				t.Errorf("Models = %v, want %v", res.Models, tt.wantModels)
+			}
+			for _, path := range tt.wantFiles {
+				if _, err := fs.Stat(mem, path); err != nil {
+					t.Errorf("file %s was not generated: %v", path, err)
+				}
+			}
+
+			if len(res.Migrations) != len(tt.wantMigrations) {
+				t.Fatalf("Migrations = %v, want %d migrations", res.Migrations, len(tt.wantMigrations))
+			}
+			for i, suffix := range tt.wantMigrations {
+				if !strings.HasSuffix(res.Migrations[i], suffix) {
+					t.Errorf("Migrations[%d] = %s, want suffix %s", i, res.Migrations[i], suffix)
+				}
+			}
+
+			for path, want := range tt.wantContent {
+				data, err := fs.ReadFile(mem, path)
+				if err != nil {
+					t.Errorf("failed to read %s: %v", path, err)
+					continue
+				}
+				// gofmt выравнивает поля, поэтому пробелы не сравниваются
+				if !strings.Contains(strings.Join(strings.Fields(string(data)), " "), want) {
+					t.Errorf("%s does not contain %q", path, want)
+				}
+			}
+
+			for _, a := range res.Artifacts {
+				if a.Change != appgen.Created {
+					t.Errorf("artifact %s is %s, want %s on the first run", a.Path, a.Change, appgen.Created)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateMemoryOptions(t *testing.T) {
+	source := writeProtos(t, map[string]string{"courier.proto": courierProto})
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name string
+		// prepare заполняет выходную файловую систему до запуска
+		prepare func(t *testing.T, mem *appgen.Memory)
+		opts    appgen.Options
+		wantErr error
+		// wantFiles - сколько файлов проекта должно оказаться в памяти,
+		// без служебных файлов .appgen; -1 - не важно
+		wantFiles   int
+		wantChanged int
+	}{
+		{
+			name:        "dry run writes nothing",
+			opts:        appgen.Options{DryRun: true},
+			wantFiles:   0,
+			wantChanged: -1,
+		},
+		{
+			name: "second run changes nothing",
+			prepare: func(t *testing.T, mem *appgen.Memory) {
+				if _, err := appgen.Generate(context.Background(), appgen.Options{Sources: []string{source}, Output: mem, Logger: discard()}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantFiles:   -1,
+			wantChanged: 0,
+		},
+		{
+			name: "BeforeWrite error stops generation",
+			opts: appgen.Options{Hooks: appgen.Hooks{
+				BeforeWrite: func(path string, data []byte) error { return errStop },
+			}},
+			wantErr:   errStop,
+			wantFiles: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := appgen.NewMemory()
+			if tt.prepare != nil {
+				tt.prepare(t, mem)
+			}
+
+			opts := tt.opts
+			opts.Sources = []string{source}
+			opts.Output = mem
+			opts.Logger = discard()
+			res, err := appgen.Generate(context.Background(), opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Generate() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			var files []string
+			for _, path := range mem.Files() {
+				if !strings.HasPrefix(path, ".appgen/") {
+					files = append(files, path)
+				}
+			}
+			if tt.wantFiles >= 0 && len(files) != tt.wantFiles {
+				t.Errorf("memory has %d project files, want %d: %v", len(files), tt.wantFiles, files)
+			}
+			if res != nil && tt.wantChanged >= 0 && len(res.Changed()) != tt.wantChanged {
+				t.Errorf("Changed() = %v, want %d changes", res.Changed(), tt.wantChanged)
+			}
+		})
+	}
+}
+
+func discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}